@@ -0,0 +1,182 @@
+package achievements
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"server/leveling"
+	"server/models"
+	"time"
+)
+
+type Metric string
+
+const (
+	// MetricCompletions is the number of periods completed
+	MetricCompletions Metric = "completions"
+	// MetricQuantity is the total quantity logged on tasks of a unit
+	MetricQuantity Metric = "quantity"
+	// MetricStreak is the longest streak reached on a task
+	MetricStreak     Metric = "streak"
+	MetricLevel      Metric = "level"
+	MetricExperience Metric = "experience"
+	MetricPurchases  Metric = "purchases"
+)
+
+var (
+	ErrInvalidDefinition = errors.New("invalid achievement definition")
+)
+
+// Definition describes an achievement, unlocked once the metric reaches the
+// threshold
+type Definition struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Metric      Metric `json:"metric"`
+	// Unit is the unit of the tasks counted by the quantity metric
+	Unit      string `json:"unit,omitempty"`
+	Threshold int64  `json:"threshold"`
+}
+
+// Achievement is the state of an achievement for a user
+type Achievement struct {
+	Definition
+	Progress   int64      `json:"progress"`
+	UnlockedAt *time.Time `json:"unlocked_at"`
+}
+
+//go:embed default.json
+var defaultDefinitions []byte
+
+var definitions []Definition
+
+// Load reads the definitions from a file, the default ones being used when
+// path is empty
+func Load(path string) error {
+	data := defaultDefinitions
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	definitions = parsed
+	return nil
+}
+
+// Parse parses and validates a JSON list of definitions
+func Parse(data []byte) ([]Definition, error) {
+	var parsed []Definition
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, definition := range parsed {
+		if definition.ID == "" || ids[definition.ID] || definition.Threshold < 1 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDefinition, definition.ID)
+		}
+		ids[definition.ID] = true
+
+		switch definition.Metric {
+		case MetricCompletions, MetricStreak, MetricLevel, MetricExperience, MetricPurchases:
+			if definition.Unit != "" {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidDefinition, definition.ID)
+			}
+		case MetricQuantity:
+			if _, err := models.UnitFromString(definition.Unit); err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidDefinition, definition.ID)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDefinition, definition.ID)
+		}
+	}
+
+	return parsed, nil
+}
+
+func (definition Definition) value(stats models.UserStats) int64 {
+	switch definition.Metric {
+	case MetricCompletions:
+		return stats.Completions
+	case MetricQuantity:
+		unit, _ := models.UnitFromString(definition.Unit)
+		return stats.Quantities[unit]
+	case MetricStreak:
+		return stats.LongestStreak
+	case MetricLevel:
+		return int64(leveling.Level(stats.Experience))
+	case MetricExperience:
+		return stats.Experience
+	case MetricPurchases:
+		return stats.Purchases
+	}
+	return 0
+}
+
+// Evaluate unlocks the achievements the user now qualifies for and returns them
+func Evaluate(conn *sql.Tx, userID string, at time.Time) ([]Achievement, error) {
+	unlocked := make([]Achievement, 0)
+
+	stats, err := models.FetchUserStats(conn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, definition := range definitions {
+		progress := definition.value(stats)
+		if progress < definition.Threshold {
+			continue
+		}
+
+		ok, err := models.UnlockAchievement(conn, userID, definition.ID, at)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			unlockedAt := at
+			unlocked = append(unlocked, Achievement{Definition: definition, Progress: progress, UnlockedAt: &unlockedAt})
+		}
+	}
+
+	return unlocked, nil
+}
+
+// List returns every achievement along with the progress of the user. Unlocked
+// achievements no longer defined are left out.
+func List(conn *sql.Tx, userID string) ([]Achievement, error) {
+	stats, err := models.FetchUserStats(conn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	userAchievements, err := models.FetchUserAchievements(conn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockedAt := make(map[string]time.Time)
+	for _, achievement := range userAchievements {
+		unlockedAt[achievement.AchievementID] = achievement.UnlockedAt
+	}
+
+	achievements := make([]Achievement, len(definitions))
+	for i, definition := range definitions {
+		achievements[i] = Achievement{Definition: definition, Progress: min(definition.value(stats), definition.Threshold)}
+		if at, ok := unlockedAt[definition.ID]; ok {
+			achievements[i].UnlockedAt = &at
+		}
+	}
+
+	return achievements, nil
+}
@@ -0,0 +1,85 @@
+package achievements
+
+import (
+	"errors"
+	"server/models"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+		err  error
+	}{
+		{"empty list", `[]`, 0, nil},
+		{"completions", `[{"id": "a", "metric": "completions", "threshold": 1}]`, 1, nil},
+		{"quantity with a unit", `[{"id": "a", "metric": "quantity", "unit": "distance", "threshold": 1000}]`, 1, nil},
+		{"every metric", `[
+			{"id": "a", "metric": "completions", "threshold": 1},
+			{"id": "b", "metric": "streak", "threshold": 7},
+			{"id": "c", "metric": "level", "threshold": 5},
+			{"id": "d", "metric": "experience", "threshold": 1000},
+			{"id": "e", "metric": "purchases", "threshold": 1}
+		]`, 5, nil},
+		{"duplicate id", `[{"id": "a", "metric": "completions", "threshold": 1}, {"id": "a", "metric": "streak", "threshold": 7}]`, 0, ErrInvalidDefinition},
+		{"missing id", `[{"metric": "completions", "threshold": 1}]`, 0, ErrInvalidDefinition},
+		{"zero threshold", `[{"id": "a", "metric": "completions", "threshold": 0}]`, 0, ErrInvalidDefinition},
+		{"negative threshold", `[{"id": "a", "metric": "completions", "threshold": -1}]`, 0, ErrInvalidDefinition},
+		{"unit on another metric", `[{"id": "a", "metric": "streak", "unit": "distance", "threshold": 7}]`, 0, ErrInvalidDefinition},
+		{"quantity without unit", `[{"id": "a", "metric": "quantity", "threshold": 1}]`, 0, ErrInvalidDefinition},
+		{"quantity with an unknown unit", `[{"id": "a", "metric": "quantity", "unit": "miles", "threshold": 1}]`, 0, ErrInvalidDefinition},
+		{"unknown metric", `[{"id": "a", "metric": "friends", "threshold": 1}]`, 0, ErrInvalidDefinition},
+	}
+
+	for _, test := range tests {
+		definitions, err := Parse([]byte(test.data))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: Parse() returned %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && len(definitions) != test.want {
+			t.Errorf("%s: Parse() returned %d definitions, want %d", test.name, len(definitions), test.want)
+		}
+	}
+
+	if _, err := Parse([]byte(`{`)); err == nil {
+		t.Errorf("Parse() of malformed JSON returned no error")
+	}
+}
+
+func TestDefaultDefinitions(t *testing.T) {
+	if _, err := Parse(defaultDefinitions); err != nil {
+		t.Errorf("the default definitions are invalid: %v", err)
+	}
+}
+
+func TestValue(t *testing.T) {
+	stats := models.UserStats{
+		Completions:   12,
+		Quantities:    map[models.Unit]int64{models.UnitDistance: 42000},
+		LongestStreak: 8,
+		Experience:    2500,
+		Purchases:     3,
+	}
+
+	tests := []struct {
+		definition Definition
+		want       int64
+	}{
+		{Definition{Metric: MetricCompletions}, 12},
+		{Definition{Metric: MetricQuantity, Unit: "distance"}, 42000},
+		{Definition{Metric: MetricQuantity, Unit: "reps"}, 0},
+		{Definition{Metric: MetricStreak}, 8},
+		{Definition{Metric: MetricLevel}, 2},
+		{Definition{Metric: MetricExperience}, 2500},
+		{Definition{Metric: MetricPurchases}, 3},
+	}
+
+	for _, test := range tests {
+		if got := test.definition.value(stats); got != test.want {
+			t.Errorf("value() of %s %s = %d, want %d", test.definition.Metric, test.definition.Unit, got, test.want)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package common
 
 import (
 	go_context "context"
+	"crypto/rand"
 	"crypto/rsa"
 	"database/sql"
+	"encoding/hex"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -17,56 +21,145 @@ import (
 
 // Configuration struct for Keycloak settings
 type Config_T struct {
-	DatabaseURL         string
-	RedisURL            string
+	DatabaseURL string
+	RedisURL    string
+	// PaymentsProvider is either stripe or fake, the fake provider letting the
+	// purchase flow run offline
+	PaymentsProvider    string
 	StripeSecretKey     string
 	StripeWebhookSecret string
 	StripePrice1KXP     string
+	StripePricePremium  string
 	Hostname            string
 	Port                string
 	PublicBaseUrl       string
+	// AllowedRedirectOrigins are the origins users can be redirected to after
+	// leaving for Stripe, including the one of PublicBaseUrl
+	AllowedRedirectOrigins []string
+	CheckoutSuccessUrl     string
+	CheckoutCancelUrl      string
+	LevelCurve             string
+	LevelBaseXP            string
+	LevelFactor            string
+	LevelTable             string
+	AchievementsPath       string
+	ShopItemsPath          string
+	// JwksURL and JwksPath locate the JSON Web Key Set of Keycloak, the keys
+	// tokens are verified with
+	JwksURL             string
+	JwksPath            string
+	JwksRefreshInterval time.Duration
+	// Expected claims of the access tokens, not checked when empty
+	JwtIssuer          string
+	JwtAudience        string
+	JwtAuthorizedParty string
+	// JwtLeeway is the clock skew tolerated on the time claims
+	JwtLeeway time.Duration
 }
 
 var (
-	Config    *Config_T
+	// Config is empty until Init is called
+	Config    = &Config_T{}
 	PublicKey *rsa.PublicKey
 	Db        *sql.DB
 	Rdb       *redis.Client
 	Ctx       = go_context.Background()
 )
 
-func init() {
+// Init reads the configuration from the environment and connects to the
+// database and Redis, exiting on misconfigurations
+func Init() {
 	godotenv.Load()
 	Config = &Config_T{
 		DatabaseURL:         os.Getenv("DATABASE_URL"),
 		RedisURL:            os.Getenv("REDIS_URL"),
+		PaymentsProvider:    os.Getenv("PAYMENTS_PROVIDER"),
 		StripeSecretKey:     os.Getenv("STRIPE_SECRET_KEY"),
 		StripeWebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
 		StripePrice1KXP:     os.Getenv("STRIPE_PRICE_1KXP"),
+		StripePricePremium:  os.Getenv("STRIPE_PRICE_PREMIUM"),
 		Hostname:            os.Getenv("HOSTNAME"),
 		Port:                os.Getenv("PORT"),
 		PublicBaseUrl:       os.Getenv("PUBLIC_BASE_URL"),
+		CheckoutSuccessUrl:  os.Getenv("CHECKOUT_SUCCESS_URL"),
+		CheckoutCancelUrl:   os.Getenv("CHECKOUT_CANCEL_URL"),
+		LevelCurve:          os.Getenv("LEVEL_CURVE"),
+		LevelBaseXP:         os.Getenv("LEVEL_BASE_XP"),
+		LevelFactor:         os.Getenv("LEVEL_FACTOR"),
+		LevelTable:          os.Getenv("LEVEL_TABLE"),
+		AchievementsPath:    os.Getenv("ACHIEVEMENTS_PATH"),
+		ShopItemsPath:       os.Getenv("SHOP_ITEMS_PATH"),
+		JwksURL:             os.Getenv("KEYCLOAK_JWKS_URL"),
+		JwksPath:            os.Getenv("KEYCLOAK_JWKS_PATH"),
+		JwtIssuer:           os.Getenv("KEYCLOAK_ISSUER"),
+		JwtAudience:         os.Getenv("KEYCLOAK_AUDIENCE"),
+		JwtAuthorizedParty:  os.Getenv("KEYCLOAK_CLIENT_ID"),
 	}
 
+	// The static public key is used for the tokens whose key is not in the
+	// JWKS, or for every token when no JWKS is configured
 	publicKeyPath := os.Getenv("KEYCLOAK_PUBLIC_KEY_PATH")
-	if publicKeyPath == "" {
-		log.Fatal("KEYCLOAK_PUBLIC_KEY_PATH is not set")
+	if publicKeyPath == "" && Config.JwksURL == "" && Config.JwksPath == "" {
+		log.Fatal("KEYCLOAK_JWKS_URL, KEYCLOAK_JWKS_PATH or KEYCLOAK_PUBLIC_KEY_PATH must be set")
 	}
 
-	if Config.StripeSecretKey == "" {
-		log.Fatal("STRIPE_SECRET_KEY is not set")
+	Config.JwksRefreshInterval = time.Hour
+	if interval := os.Getenv("KEYCLOAK_JWKS_REFRESH_INTERVAL"); interval != "" {
+		refreshInterval, err := time.ParseDuration(interval)
+		if err != nil || refreshInterval <= 0 {
+			log.Fatal("KEYCLOAK_JWKS_REFRESH_INTERVAL is invalid")
+		}
+		Config.JwksRefreshInterval = refreshInterval
+	}
+
+	Config.JwtLeeway = 30 * time.Second
+	if leeway := os.Getenv("JWT_LEEWAY"); leeway != "" {
+		jwtLeeway, err := time.ParseDuration(leeway)
+		if err != nil || jwtLeeway < 0 {
+			log.Fatal("JWT_LEEWAY is invalid")
+		}
+		Config.JwtLeeway = jwtLeeway
 	}
 
 	if Config.DatabaseURL == "" {
 		log.Fatal("DATABASE_URL is not set")
 	}
 
-	if Config.StripeWebhookSecret == "" {
-		log.Fatal("STRIPE_WEBHOOK_SECRET is not set")
+	// The fake provider must be asked for explicitly, a missing Stripe key
+	// being a misconfiguration
+	if Config.PaymentsProvider == "" {
+		Config.PaymentsProvider = "stripe"
 	}
 
-	if Config.StripePrice1KXP == "" {
-		log.Fatal("STRIPE_PRICE_1KXP is not set")
+	switch Config.PaymentsProvider {
+	case "stripe":
+		if Config.StripeSecretKey == "" {
+			log.Fatal("STRIPE_SECRET_KEY is not set")
+		}
+
+		if Config.StripeWebhookSecret == "" {
+			log.Fatal("STRIPE_WEBHOOK_SECRET is not set")
+		}
+
+		if Config.StripePrice1KXP == "" {
+			log.Fatal("STRIPE_PRICE_1KXP is not set")
+		}
+	case "fake":
+		// The fake provider signs its events with this secret, which is random
+		// unless set so that nobody else can forge events
+		if Config.StripeWebhookSecret == "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				log.Fatal(err)
+			}
+			Config.StripeWebhookSecret = "whsec_" + hex.EncodeToString(secret)
+		}
+
+		if Config.StripePricePremium == "" {
+			Config.StripePricePremium = "price_fake_premium"
+		}
+	default:
+		log.Fatal("PAYMENTS_PROVIDER must be stripe or fake")
 	}
 
 	if Config.Hostname == "" {
@@ -81,6 +174,25 @@ func init() {
 		Config.PublicBaseUrl = "http://" + Config.Hostname + ":" + Config.Port
 	}
 
+	publicBaseUrl, err := url.Parse(Config.PublicBaseUrl)
+	if err != nil || publicBaseUrl.Host == "" {
+		log.Fatal("PUBLIC_BASE_URL is invalid")
+	}
+	Config.AllowedRedirectOrigins = []string{publicBaseUrl.Scheme + "://" + publicBaseUrl.Host}
+	for _, origin := range strings.Split(os.Getenv("ALLOWED_REDIRECT_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			Config.AllowedRedirectOrigins = append(Config.AllowedRedirectOrigins, origin)
+		}
+	}
+
+	if Config.CheckoutSuccessUrl == "" {
+		Config.CheckoutSuccessUrl = strings.TrimRight(Config.PublicBaseUrl, "/") + "/checkout/success?session_id={CHECKOUT_SESSION_ID}"
+	}
+
+	if Config.CheckoutCancelUrl == "" {
+		Config.CheckoutCancelUrl = strings.TrimRight(Config.PublicBaseUrl, "/") + "/checkout/cancel"
+	}
+
 	if Config.RedisURL != "" {
 		redisConfig, err := redis.ParseURL(Config.RedisURL)
 		if err != nil {
@@ -99,20 +211,21 @@ func init() {
 		}
 	}
 
-	var err error
 	Db, err = sql.Open("postgres", Config.DatabaseURL)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	publicKeyBytes, err := os.ReadFile(publicKeyPath)
-	if err != nil {
-		log.Fatal(err)
-	}
+	if publicKeyPath != "" {
+		publicKeyBytes, err := os.ReadFile(publicKeyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicKeyBytes)
-	if err != nil {
-		log.Fatal(err)
+		PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicKeyBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	stripe.Key = Config.StripeSecretKey
@@ -0,0 +1,165 @@
+package adminController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"server/common"
+	"server/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateCategory creates a global category, shared by everyone
+func HandleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	var payload categoryPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	category := models.Category{
+		ID:   uuid.New().String(),
+		Name: payload.Name,
+	}
+
+	err = models.CreateCategory(tx, category)
+	if err == models.ErrCategoryExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCategory(w, category, http.StatusCreated)
+}
+
+// HandleUpdateCategory renames a global category
+func HandleUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	var payload categoryPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	category, ok := fetchGlobalCategory(w, tx, mux.Vars(r)["uuid"])
+	if !ok {
+		return
+	}
+
+	category.Name = payload.Name
+	err = models.UpdateCategory(tx, category)
+	if err == models.ErrCategoryExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCategory(w, category, http.StatusOK)
+}
+
+// HandleDeleteCategory deletes a global category, unassigning it from its
+// tasks
+func HandleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	category, ok := fetchGlobalCategory(w, tx, mux.Vars(r)["uuid"])
+	if !ok {
+		return
+	}
+
+	err = models.DeleteCategory(tx, category.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fetchGlobalCategory fetches a global category, answering 404 if there is
+// none. Custom categories are left to their user.
+func fetchGlobalCategory(w http.ResponseWriter, tx *sql.Tx, categoryID string) (models.Category, bool) {
+	if _, err := uuid.Parse(categoryID); err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return models.Category{}, false
+	}
+
+	category, err := models.FetchOneCategory(tx, categoryID)
+	if err == sql.ErrNoRows || (err == nil && category.UserID != nil) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return models.Category{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return models.Category{}, false
+	}
+	return category, true
+}
+
+func writeCategory(w http.ResponseWriter, category models.Category, status int) {
+	jsonData, err := json.Marshal(category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
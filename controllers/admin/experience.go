@@ -0,0 +1,97 @@
+package adminController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"server/achievements"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"server/session"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAdjustExperience adds an entry to the experience ledger of a user,
+// e.g. to compensate for a bug or to take back experience gained by cheating
+func HandleAdjustExperience(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["uuid"]
+
+	var payload experiencePayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if payload.Amount == 0 {
+		http.Error(w, "Missing amount", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := models.FetchOneUser(tx, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if user.Experience+payload.Amount < 0 {
+		http.Error(w, "Experience cannot become negative", http.StatusBadRequest)
+		return
+	}
+
+	// The entry references the administrator who made it
+	admin := principal.FromRequest(r)
+	entry, err := models.AddExperience(tx, models.ExperienceEntry{
+		UserID:      user.UserID,
+		Amount:      payload.Amount,
+		Source:      models.ExperienceSourceAdminAdjustment,
+		ReferenceID: &admin.UserID,
+		Note:        payload.Note,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = achievements.Evaluate(tx, user.UserID, entry.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("experience of user %s adjusted by %d points by %s", user.UserID, payload.Amount, admin.UserID)
+	if err := session.Invalidate(user.UserID); err != nil {
+		log.Printf("Failed to invalidate the sessions of user %s: %v", user.UserID, err)
+	}
+
+	jsonData, err := json.Marshal(entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
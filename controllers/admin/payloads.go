@@ -0,0 +1,23 @@
+package adminController
+
+type publicTaskPayload struct {
+	Quantity         int    `json:"quantity"`
+	Unit             string `json:"unit"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Frequency        string `json:"frequency"`
+	ExperienceGained int    `json:"experience_gained"`
+	// Categories are global category IDs, leaving them out keeps the current ones on update
+	Categories []string `json:"categories"`
+}
+
+type categoryPayload struct {
+	Name string `json:"name"`
+}
+
+type experiencePayload struct {
+	// Amount is added to the experience of the user, negative amounts taking
+	// experience back
+	Amount int64   `json:"amount"`
+	Note   *string `json:"note"`
+}
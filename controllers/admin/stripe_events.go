@@ -0,0 +1,60 @@
+package adminController
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/common"
+	"server/models"
+	"strconv"
+)
+
+// HandleGetStripeEvents lists the Stripe events received, optionally filtered
+// by status, for reconciliation
+func HandleGetStripeEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var status *models.StripeEventStatus
+	if s := query.Get("status"); s != "" {
+		parsed, err := models.StripeEventStatusFromString(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status = &parsed
+	}
+
+	limit := 50
+	offset := 0
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil || p < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		offset = (p - 1) * limit
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	events, count, err := models.FetchStripeEvents(tx, status, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"events": %s, "current_page": %d, "max_page": %d}`, jsonData, offset/limit+1, max(count-1, 0)/limit+1)))
+}
@@ -0,0 +1,252 @@
+package adminController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Maximum experience gained by completing a public task
+const maxTaskExperience = 1000
+
+var errInvalidExperience = errors.New("invalid experience_gained")
+
+// makePublicTask validates the payload of a public task
+func makePublicTask(taskID string, payload publicTaskPayload) (models.Task, error) {
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		return models.Task{}, errors.New("missing name")
+	}
+
+	unit, err := models.UnitFromString(payload.Unit)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	if err := unit.ValidateQuantity(payload.Quantity); err != nil {
+		return models.Task{}, err
+	}
+
+	frequency, err := models.ParseFrequency(payload.Frequency)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	if payload.ExperienceGained <= 0 || payload.ExperienceGained > maxTaskExperience {
+		return models.Task{}, errInvalidExperience
+	}
+
+	return models.Task{
+		TaskID:           taskID,
+		Quantity:         payload.Quantity,
+		Unit:             unit,
+		Name:             payload.Name,
+		Description:      payload.Description,
+		Frequency:        frequency,
+		ExperienceGained: payload.ExperienceGained,
+		IsPublic:         true,
+	}, nil
+}
+
+// HandleCreatePublicTask adds a task to the public catalog
+func HandleCreatePublicTask(w http.ResponseWriter, r *http.Request) {
+	var payload publicTaskPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := makePublicTask(uuid.New().String(), payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Public tasks can only be in global categories
+	if err := models.ValidateCategories(tx, "", payload.Categories); err != nil {
+		if err == models.ErrInvalidCategory {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = models.CreateTask(tx, task)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(payload.Categories) > 0 {
+		err = models.SetTaskCategories(tx, task.TaskID, payload.Categories)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeTask(w, tx, task.TaskID, principal.FromRequest(r).UserID, http.StatusCreated)
+}
+
+// HandleUpdatePublicTask updates a task of the public catalog, for every user
+// who adopted it, publishing it again if it was removed from the catalog
+func HandleUpdatePublicTask(w http.ResponseWriter, r *http.Request) {
+	taskID := mux.Vars(r)["uuid"]
+
+	var payload publicTaskPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := makePublicTask(taskID, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	previous, ok := fetchCatalogTask(w, tx, taskID, principal.FromRequest(r).UserID)
+	if !ok {
+		return
+	}
+
+	// Keep the recurrence anchored on the same day unless a new start is given
+	if task.Frequency.Start.IsZero() {
+		task.Frequency.Start = previous.Frequency.Start
+	}
+
+	if err := models.ValidateCategories(tx, "", payload.Categories); err != nil {
+		if err == models.ErrInvalidCategory {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = models.UpdateTask(tx, task)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if task.Frequency.String() != previous.Frequency.String() {
+		err = models.ResetStreaks(tx, task.TaskID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if payload.Categories != nil {
+		err = models.SetTaskCategories(tx, task.TaskID, payload.Categories)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeTask(w, tx, task.TaskID, principal.FromRequest(r).UserID, http.StatusOK)
+}
+
+// HandleUnpublishTask removes a task from the public catalog. Users who
+// adopted it keep tracking it along with their completion history.
+func HandleUnpublishTask(w http.ResponseWriter, r *http.Request) {
+	taskID := mux.Vars(r)["uuid"]
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	task, ok := fetchCatalogTask(w, tx, taskID, principal.FromRequest(r).UserID)
+	if !ok {
+		return
+	}
+
+	task.IsPublic = false
+	err = models.UpdateTask(tx, task)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fetchCatalogTask fetches a task of the catalog, published or not, answering
+// 404 if there is none. Custom tasks, which have an owner, are left to them.
+func fetchCatalogTask(w http.ResponseWriter, tx *sql.Tx, taskID string, userID string) (models.Task, bool) {
+	if _, err := uuid.Parse(taskID); err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return models.Task{}, false
+	}
+
+	task, err := models.FetchOneTask(tx, taskID, userID)
+	if err == sql.ErrNoRows || (err == nil && task.UserID != nil) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return models.Task{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return models.Task{}, false
+	}
+	return task, true
+}
+
+// writeTask commits the transaction and answers with the task, as seen by
+// the given user
+func writeTask(w http.ResponseWriter, tx *sql.Tx, taskID string, userID string, status int) {
+	task, err := models.FetchOneTask(tx, taskID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(task)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
@@ -2,36 +2,31 @@ package authController
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"server/common"
+	"server/leveling"
 	"server/models"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/gorilla/context"
+	"server/principal"
 )
 
 func HandleGet(w http.ResponseWriter, r *http.Request) {
-	log.Println("HandleGet")
 	tx, err := common.Db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer tx.Commit()
 
-	userID, err := context.Get(r, "user").(jwt.MapClaims).GetSubject()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	user, err := models.FetchOneUserByCloudIamSub(tx, userID)
+	user, err := models.FetchOneUser(tx, principal.FromRequest(r).UserID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userRaw, err := json.Marshal(user)
+	userRaw, err := json.Marshal(struct {
+		models.User
+		leveling.Progress
+	}{user, leveling.ProgressOf(user.Experience)})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
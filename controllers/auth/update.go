@@ -0,0 +1,83 @@
+package authController
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"server/common"
+	"server/leaderboard"
+	"server/models"
+	"server/principal"
+	"server/session"
+	"time"
+)
+
+type updatePayload struct {
+	Timezone          *string `json:"timezone"`
+	LeaderboardOptOut *bool   `json:"leaderboard_opt_out"`
+}
+
+func HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	var payload updatePayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := models.FetchOneUser(tx, principal.FromRequest(r).UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if payload.Timezone != nil {
+		if _, err := time.LoadLocation(*payload.Timezone); err != nil || *payload.Timezone == "" {
+			http.Error(w, "invalid timezone", http.StatusBadRequest)
+			return
+		}
+		user.Timezone = *payload.Timezone
+	}
+
+	optOutChanged := payload.LeaderboardOptOut != nil && *payload.LeaderboardOptOut != user.LeaderboardOptOut
+	if payload.LeaderboardOptOut != nil {
+		user.LeaderboardOptOut = *payload.LeaderboardOptOut
+	}
+
+	err = models.Update(tx, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := session.Invalidate(user.UserID); err != nil {
+		log.Printf("Failed to invalidate the sessions of user %s: %v", user.UserID, err)
+	}
+
+	if optOutChanged {
+		if err := leaderboard.Invalidate(); err != nil {
+			log.Printf("Failed to invalidate the leaderboards: %v", err)
+		}
+	}
+
+	userRaw, err := json.Marshal(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(userRaw)
+}
@@ -0,0 +1,68 @@
+package categoryController
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Users can only create custom categories, global ones are managed by administrators
+func HandleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	var payload categoryPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user := principal.FromRequest(r)
+
+	category := models.Category{
+		ID:     uuid.New().String(),
+		Name:   payload.Name,
+		UserID: &user.UserID,
+	}
+
+	err = models.CreateCategory(tx, category)
+	if err == models.ErrCategoryExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
@@ -0,0 +1,93 @@
+package categoryController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func HandleGetCategories(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	limit := 50
+	offset := 0
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil || p < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		offset = (p - 1) * limit
+	}
+
+	categories, err := models.FetchAllCategories(tx, user.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	count, err := models.CountCategories(tx, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(categories)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"categories": %s, "current_page": %d, "max_page": %d}`, jsonData, offset/limit+1, (count-1)/limit+1)))
+}
+
+func HandleGetCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	category, err := models.FetchOneCategory(tx, uuid)
+	if err == sql.ErrNoRows || (err == nil && !category.IsVisibleTo(user.UserID)) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
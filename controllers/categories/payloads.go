@@ -0,0 +1,5 @@
+package categoryController
+
+type categoryPayload struct {
+	Name string `json:"name"`
+}
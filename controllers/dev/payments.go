@@ -0,0 +1,86 @@
+package devController
+
+import (
+	"html/template"
+	"net/http"
+	"server/payments"
+
+	"github.com/gorilla/mux"
+)
+
+var checkoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake checkout</title></head>
+<body>
+	<h1>Fake checkout {{.ID}}</h1>
+	<p>Mode: {{.Mode}}, status: {{.Status}}, amount: {{.AmountTotal}} cents</p>
+	<ul>
+	{{range .LineItems}}<li>{{.Quantity}} × {{.Price}}</li>{{end}}
+	</ul>
+	{{if eq .Status "open"}}
+	<form method="post" action="{{.ID}}/complete"><button type="submit">Pay</button></form>
+	<form method="post" action="{{.ID}}/cancel"><button type="submit">Cancel</button></form>
+	{{else if and (eq .Status "complete") (not .Refunded)}}
+	<form method="post" action="{{.ID}}/refund"><button type="submit">{{if .SubscriptionID}}Cancel subscription{{else}}Refund{{end}}</button></form>
+	{{end}}
+</body>
+</html>
+`))
+
+// HandleGetCheckout renders the checkout page of the fake payments provider
+func HandleGetCheckout(w http.ResponseWriter, r *http.Request) {
+	sess, ok := payments.Fake().Session(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, payments.ErrUnknownSession.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	checkoutPage.Execute(w, sess)
+}
+
+// HandleCompleteCheckout pays a fake checkout session, which sends the
+// signed events to the webhook, and redirects to its success URL
+func HandleCompleteCheckout(w http.ResponseWriter, r *http.Request) {
+	sess, err := payments.Fake().Complete(mux.Vars(r)["id"])
+	if !handleFakeError(w, err) {
+		return
+	}
+
+	http.Redirect(w, r, sess.SuccessURL, http.StatusSeeOther)
+}
+
+// HandleCancelCheckout abandons a fake checkout session and redirects to its
+// cancel URL
+func HandleCancelCheckout(w http.ResponseWriter, r *http.Request) {
+	sess, err := payments.Fake().Cancel(mux.Vars(r)["id"])
+	if !handleFakeError(w, err) {
+		return
+	}
+
+	http.Redirect(w, r, sess.CancelURL, http.StatusSeeOther)
+}
+
+// HandleRefundCheckout refunds a fake payment or cancels a fake subscription
+func HandleRefundCheckout(w http.ResponseWriter, r *http.Request) {
+	sess, err := payments.Fake().Refund(mux.Vars(r)["id"])
+	if !handleFakeError(w, err) {
+		return
+	}
+
+	http.Redirect(w, r, "/api/v1/dev/payments/checkout/"+sess.ID, http.StatusSeeOther)
+}
+
+func handleFakeError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case payments.ErrUnknownSession:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case payments.ErrSessionState:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package leaderboardController
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/common"
+	"server/leaderboard"
+	"server/models"
+	"server/principal"
+	"strconv"
+	"time"
+)
+
+func HandleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	period := models.LeaderboardGlobal
+	if p := query.Get("period"); p != "" {
+		var err error
+		period, err = models.LeaderboardPeriodFromString(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := 50
+	offset := 0
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil || p < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		offset = (p - 1) * limit
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	page, err := leaderboard.Fetch(tx, period, time.Now(), user.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entriesData, err := json.Marshal(page.Entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	meData, err := json.Marshal(page.Me)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"period": %q, "entries": %s, "me": %s, "current_page": %d, "max_page": %d}`, period, entriesData, meData, offset/limit+1, max(page.Total-1, 0)/limit+1)))
+}
@@ -0,0 +1,37 @@
+package meController
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/achievements"
+	"server/common"
+	"server/principal"
+)
+
+// HandleGetAchievements returns every achievement, unlocked or not, along with
+// the progress of the user towards it
+func HandleGetAchievements(w http.ResponseWriter, r *http.Request) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	list, err := achievements.List(tx, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
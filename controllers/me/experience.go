@@ -0,0 +1,56 @@
+package meController
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"strconv"
+)
+
+// HandleGetExperience returns the experience ledger of the user
+func HandleGetExperience(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 50
+	offset := 0
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil || p < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		offset = (p - 1) * limit
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user, err := models.FetchOneUser(tx, principal.FromRequest(r).UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries, count, err := models.FetchExperienceEntries(tx, user.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"experience": %d, "entries": %s, "current_page": %d, "max_page": %d}`, user.Experience, jsonData, offset/limit+1, max(count-1, 0)/limit+1)))
+}
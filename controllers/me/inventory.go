@@ -0,0 +1,36 @@
+package meController
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+)
+
+// HandleGetInventory returns the items owned by the user, such as streak freezes
+func HandleGetInventory(w http.ResponseWriter, r *http.Request) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	inventory, err := models.FetchInventory(tx, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(inventory)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
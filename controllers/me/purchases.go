@@ -0,0 +1,52 @@
+package meController
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"strconv"
+)
+
+// HandleGetPurchases returns the purchase history of the user
+func HandleGetPurchases(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 50
+	offset := 0
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil || p < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		offset = (p - 1) * limit
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	purchases, count, err := models.FetchPurchases(tx, user.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(purchases)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"purchases": %s, "current_page": %d, "max_page": %d}`, jsonData, offset/limit+1, max(count-1, 0)/limit+1)))
+}
@@ -0,0 +1,52 @@
+package meController
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"time"
+)
+
+// Number of days covered by the daily activity of the statistics
+const statsDays = 30
+
+// HandleGetStats returns the statistics of the user along with their daily
+// activity over the last days
+func HandleGetStats(w http.ResponseWriter, r *http.Request) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	stats, err := models.FetchUserStats(tx, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(user.Location())
+	from := time.Date(now.Year(), now.Month(), now.Day()-statsDays+1, 0, 0, 0, 0, now.Location())
+	activity, err := models.FetchDailyActivity(tx, user.UserID, now.Location(), from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(struct {
+		models.UserStats
+		Daily []models.DailyActivity `json:"daily"`
+	}{stats, activity})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
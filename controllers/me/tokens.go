@@ -0,0 +1,186 @@
+package meController
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Users can have this many personal access tokens which are neither revoked
+// nor expired
+const maxAccessTokens = 20
+
+// Personal access tokens can be valid for a year at most
+const maxAccessTokenDays = 365
+
+type createAccessTokenPayload struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is the lifetime of the token, which never expires if omitted
+	ExpiresInDays *int `json:"expires_in_days"`
+}
+
+// HandleGetAccessTokens lists the personal access tokens of the user
+func HandleGetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	tokens, err := models.FetchAccessTokens(tx, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(tokens)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
+
+// HandleCreateAccessToken creates a personal access token, which is only
+// returned in the response
+func HandleCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	var payload createAccessTokenPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	if len(payload.Scopes) == 0 {
+		http.Error(w, "Missing scopes", http.StatusBadRequest)
+		return
+	}
+
+	scopes := make([]models.AccessTokenScope, 0, len(payload.Scopes))
+	for _, s := range payload.Scopes {
+		scope, err := models.AccessTokenScopeFromString(s)
+		if err != nil {
+			http.Error(w, err.Error()+": "+s, http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	now := time.Now()
+	var expiresAt *time.Time
+	if payload.ExpiresInDays != nil {
+		if *payload.ExpiresInDays < 1 || *payload.ExpiresInDays > maxAccessTokenDays {
+			http.Error(w, "invalid expires_in_days", http.StatusBadRequest)
+			return
+		}
+		expiration := now.AddDate(0, 0, *payload.ExpiresInDays)
+		expiresAt = &expiration
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user := principal.FromRequest(r)
+
+	count, err := models.CountActiveAccessTokens(tx, user.UserID, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAccessTokens {
+		http.Error(w, "Too many personal access tokens", http.StatusConflict)
+		return
+	}
+
+	secret, err := models.GenerateAccessToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := models.CreateAccessToken(tx, models.AccessToken{
+		UserID:    user.UserID,
+		Name:      payload.Name,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}, secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(struct {
+		models.AccessToken
+		Token string `json:"token"`
+	}{token, secret})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+// HandleRevokeAccessToken revokes a personal access token of the user
+func HandleRevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	tokenID := mux.Vars(r)["uuid"]
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user := principal.FromRequest(r)
+
+	revoked, err := models.RevokeAccessToken(tx, user.UserID, tokenID, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !revoked {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
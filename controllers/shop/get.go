@@ -0,0 +1,18 @@
+package shopController
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/shop"
+)
+
+func HandleGetItems(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := json.Marshal(shop.Items())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"items": ` + string(jsonData) + `}`))
+}
@@ -2,57 +2,102 @@ package stripeCheckoutController
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"server/common"
+	"server/payments"
+	"server/principal"
+	"server/redirect"
+	"server/shop"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/gorilla/context"
 	"github.com/stripe/stripe-go/v82"
-	"github.com/stripe/stripe-go/v82/checkout/session"
 )
 
 type experienceCheckoutPayload struct {
 	SuccessUrl string `json:"successUrl"`
 	CancelUrl  string `json:"cancelUrl"`
+	// Item is the shop item bought, 1000 experience points by default
+	Item     string `json:"item"`
+	Quantity int64  `json:"quantity"`
 }
 
 type response struct {
 	Url string `json:"url"`
 }
 
-// Buy 1000 experience points
+// Buy an item of the shop
 func HandleExperienceCheckout(w http.ResponseWriter, r *http.Request) {
+	// The payload is optional, the redirect URLs having defaults
 	payload := experienceCheckoutPayload{}
 	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	successUrl, err := redirect.Resolve(payload.SuccessUrl, common.Config.CheckoutSuccessUrl, redirect.CheckoutSessionID)
+	if err != nil {
+		http.Error(w, "successUrl: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cancelUrl, err := redirect.Resolve(payload.CancelUrl, common.Config.CheckoutCancelUrl)
+	if err != nil {
+		http.Error(w, "cancelUrl: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if payload.Item == "" {
+		payload.Item = "experience_1000"
+	}
+	if payload.Quantity == 0 {
+		payload.Quantity = 1
+	}
+
+	item, err := shop.ItemByID(payload.Item)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := item.ValidateQuantity(payload.Quantity); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if payload.SuccessUrl == "" || payload.CancelUrl == "" {
-		http.Error(w, "Missing successUrl or cancelUrl", http.StatusBadRequest)
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
 
-	userID, err := context.Get(r, "user").(jwt.MapClaims).GetSubject()
+	customerID, err := ensureCustomer(tx, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	params := &stripe.CheckoutSessionParams{
+		Customer:           stripe.String(customerID),
 		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
-				Price:    stripe.String(common.Config.StripePrice1KXP),
-				Quantity: stripe.Int64(1),
+				Price:    stripe.String(item.StripePrice),
+				Quantity: stripe.Int64(payload.Quantity),
 			},
 		},
-		Mode:       stripe.String("payment"),
-		SuccessURL: stripe.String(payload.SuccessUrl),
-		CancelURL:  stripe.String(payload.CancelUrl),
+		Mode:              stripe.String("payment"),
+		SuccessURL:        stripe.String(successUrl),
+		CancelURL:         stripe.String(cancelUrl),
+		ClientReferenceID: stripe.String(user.CloudIamSub),
 		Metadata: map[string]string{
-			"userId": userID,
+			"userId": user.CloudIamSub,
 		},
 	}
 
-	sess, err := session.New(params)
+	sess, err := payments.NewCheckoutSession(params)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,34 @@
+package stripeCheckoutController
+
+import (
+	"database/sql"
+	"server/models"
+	"server/payments"
+	"server/principal"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// ensureCustomer returns the Stripe customer of the user, creating it on their
+// first checkout so that every session is attached to the same customer
+func ensureCustomer(tx *sql.Tx, user principal.Principal) (string, error) {
+	customerID, err := models.FetchStripeCustomerID(tx, user.UserID)
+	if err != nil {
+		return "", err
+	}
+	if customerID != nil {
+		return *customerID, nil
+	}
+
+	c, err := payments.NewCustomer(&stripe.CustomerParams{
+		Metadata: map[string]string{
+			"userId": user.CloudIamSub,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = models.LinkStripeCustomer(tx, user.UserID, c.ID)
+	return c.ID, err
+}
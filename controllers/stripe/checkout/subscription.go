@@ -0,0 +1,104 @@
+package stripeCheckoutController
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"server/common"
+	"server/payments"
+	"server/principal"
+	"server/redirect"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+type subscriptionCheckoutPayload struct {
+	SuccessUrl string `json:"successUrl"`
+	CancelUrl  string `json:"cancelUrl"`
+}
+
+// Subscribe to Hobbit Premium
+func HandleSubscriptionCheckout(w http.ResponseWriter, r *http.Request) {
+	if common.Config.StripePricePremium == "" {
+		http.Error(w, "Premium subscriptions are not available", http.StatusNotFound)
+		return
+	}
+
+	// The payload is optional, the redirect URLs having defaults
+	payload := subscriptionCheckoutPayload{}
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	successUrl, err := redirect.Resolve(payload.SuccessUrl, common.Config.CheckoutSuccessUrl, redirect.CheckoutSessionID)
+	if err != nil {
+		http.Error(w, "successUrl: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cancelUrl, err := redirect.Resolve(payload.CancelUrl, common.Config.CheckoutCancelUrl)
+	if err != nil {
+		http.Error(w, "cancelUrl: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	if user.Premium {
+		http.Error(w, "Already subscribed", http.StatusConflict)
+		return
+	}
+
+	customerID, err := ensureCustomer(tx, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		Customer: stripe.String(customerID),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(common.Config.StripePricePremium),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode:              stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SuccessURL:        stripe.String(successUrl),
+		CancelURL:         stripe.String(cancelUrl),
+		ClientReferenceID: stripe.String(user.CloudIamSub),
+		Metadata: map[string]string{
+			"userId": user.CloudIamSub,
+		},
+		// The subscription events only carry the metadata of the subscription
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{
+				"userId": user.CloudIamSub,
+			},
+		},
+	}
+
+	sess, err := payments.NewCheckoutSession(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := response{Url: sess.URL}
+	rawResponse, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(rawResponse)
+}
@@ -0,0 +1,76 @@
+package stripePortalController
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/payments"
+	"server/principal"
+	"server/redirect"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+type portalPayload struct {
+	ReturnUrl string `json:"returnUrl"`
+}
+
+type response struct {
+	Url string `json:"url"`
+}
+
+// Open the Stripe Billing Portal, where users manage their payment methods,
+// invoices and subscription
+func HandleCreatePortalSession(w http.ResponseWriter, r *http.Request) {
+	// The payload is optional, the redirect URLs having defaults
+	payload := portalPayload{}
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	returnUrl, err := redirect.Resolve(payload.ReturnUrl, common.Config.PublicBaseUrl)
+	if err != nil {
+		http.Error(w, "returnUrl: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	customerID, err := models.FetchStripeCustomerID(tx, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if customerID == nil {
+		http.Error(w, "No billing account, make a purchase first", http.StatusNotFound)
+		return
+	}
+
+	sess, err := payments.NewPortalSession(&stripe.BillingPortalSessionParams{
+		Customer:  customerID,
+		ReturnURL: stripe.String(returnUrl),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rawResponse, err := json.Marshal(response{Url: sess.URL})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(rawResponse)
+}
@@ -1,14 +1,21 @@
 package stripeController
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"server/achievements"
 	"server/common"
 	"server/models"
+	"server/payments"
+	"server/session"
+	"server/shop"
+	"strings"
+	"time"
 
 	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/webhook"
@@ -38,44 +45,458 @@ func HandleWebhook(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Unmarshal the event data into an appropriate struct depending on its Type
+	// Whatever the handler needs from Stripe is fetched before the transaction
+	// is started, so that no lock is held during network calls
+	handler, err := prepareHandler(event)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error preparing event %s: %v\n", event.ID, err)
+		recordFailure(event, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Recording the event in the same transaction as its side effects makes
+	// retried deliveries of an event already processed no-ops
+	status := models.StripeEventIgnored
+	if handler != nil {
+		status = models.StripeEventProcessed
+	}
+	recorded, err := models.RecordStripeEvent(tx, event.ID, string(event.Type), status, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording event: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !recorded {
+		log.Printf("stripe event %s already processed", event.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID := ""
+	if handler != nil {
+		userID, err = handler(tx, event)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing event %s: %v\n", event.ID, err)
+		tx.Rollback()
+		recordFailure(event, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if userID != "" {
+		if err := session.Invalidate(userID); err != nil {
+			log.Printf("Failed to invalidate the sessions of user %s: %v", userID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// eventHandler applies an event within the transaction recording it, and
+// returns the user whose account changed, if any
+type eventHandler func(tx *sql.Tx, event stripe.Event) (string, error)
+
+// eventHandlers are the handlers of the events which need nothing more than
+// their payload
+var eventHandlers = map[stripe.EventType]eventHandler{
+	stripe.EventTypeChargeRefunded:              handleChargeRefunded,
+	stripe.EventTypeChargeDisputeCreated:        handleDispute,
+	stripe.EventTypeChargeDisputeClosed:         handleDispute,
+	stripe.EventTypeCustomerSubscriptionCreated: handleSubscription,
+	stripe.EventTypeCustomerSubscriptionUpdated: handleSubscription,
+	stripe.EventTypeCustomerSubscriptionDeleted: handleSubscription,
+	stripe.EventTypeInvoicePaymentFailed:        handleInvoicePaymentFailed,
+}
+
+// prepareHandler returns the handler of an event, nil for the events which are
+// ignored. Checkout sessions get their line items fetched beforehand.
+func prepareHandler(event stripe.Event) (eventHandler, error) {
 	switch event.Type {
-	case "checkout.session.completed":
-		tx, err := common.Db.Begin()
+	case stripe.EventTypeCheckoutSessionCompleted, stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded, stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		var sess stripe.CheckoutSession
+		err := json.Unmarshal(event.Data.Raw, &sess)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting transaction: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return nil, fmt.Errorf("parsing webhook JSON: %w", err)
 		}
 
-		var paymentIntent stripe.PaymentIntent
-		err = json.Unmarshal(event.Data.Raw, &paymentIntent)
+		// Subscriptions are handled through their own events
+		if sess.Mode == stripe.CheckoutSessionModeSubscription {
+			return func(tx *sql.Tx, event stripe.Event) (string, error) { return "", nil }, nil
+		}
+
+		items, err := purchasedItems(sess.ID)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing webhook JSON: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return nil, err
+		}
+
+		return func(tx *sql.Tx, event stripe.Event) (string, error) {
+			return handleCheckoutSession(tx, event, sess, items)
+		}, nil
+	}
+
+	return eventHandlers[event.Type], nil
+}
+
+// handleCheckoutSession records the purchase of a checkout session, granting
+// its items once it is paid. Sessions paid with asynchronous payment methods
+// are completed before being paid.
+func handleCheckoutSession(tx *sql.Tx, event stripe.Event, sess stripe.CheckoutSession, items []models.PurchaseItem) (string, error) {
+	status := models.PurchaseStatusPending
+	switch {
+	case event.Type == stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		status = models.PurchaseStatusFailed
+	case sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid:
+		status = models.PurchaseStatusPaid
+	}
+
+	purchase, err := models.FetchPurchaseBySessionID(tx, sess.ID)
+	if err == sql.ErrNoRows {
+		userID := sess.Metadata["userId"]
+		if userID == "" {
+			userID = sess.ClientReferenceID
 		}
-		log.Printf("user %s purchased 1000 experience points", paymentIntent.Metadata["userId"])
-		user, err := models.FetchOneUserByCloudIamSub(tx, paymentIntent.Metadata["userId"])
+		user, err := models.FetchOneUserByCloudIamSub(tx, userID)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error fetching user: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return "", fmt.Errorf("fetching user: %w", err)
+		}
+
+		if sess.Customer != nil {
+			err = models.LinkStripeCustomer(tx, user.UserID, sess.Customer.ID)
+			if err != nil {
+				return "", fmt.Errorf("linking customer: %w", err)
+			}
+		}
+
+		productIDs := make([]string, len(items))
+		experience := int64(0)
+		for i, item := range items {
+			productIDs[i] = item.ItemID
+			if item.InventoryItemID == nil {
+				experience += item.Amount
+			}
 		}
-		user.Rank += 1.0
-		err = models.Update(tx, user)
+
+		var paymentIntentID *string
+		if sess.PaymentIntent != nil {
+			paymentIntentID = &sess.PaymentIntent.ID
+		}
+
+		purchase, err = models.CreatePurchase(tx, models.Purchase{
+			UserID:          user.UserID,
+			SessionID:       sess.ID,
+			PaymentIntentID: paymentIntentID,
+			Amount:          sess.AmountTotal,
+			Currency:        string(sess.Currency),
+			Product:         strings.Join(productIDs, ","),
+			Items:           items,
+			Experience:      experience,
+			Status:          models.PurchaseStatusPending,
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error updating user: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return "", fmt.Errorf("recording purchase: %w", err)
 		}
-		err = tx.Commit()
+	} else if err != nil {
+		return "", fmt.Errorf("fetching purchase: %w", err)
+	}
+
+	// Only pending purchases are settled by checkout events, the paid ones
+	// having already granted their experience
+	if purchase.Status != models.PurchaseStatusPending || status == purchase.Status {
+		return "", nil
+	}
+
+	err = models.UpdatePurchaseStatus(tx, purchase.PurchaseID, status, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("updating purchase: %w", err)
+	}
+	if status != models.PurchaseStatusPaid {
+		return "", nil
+	}
+
+	log.Printf("user %s purchased %s", purchase.UserID, purchase.Product)
+	purchase.Status = status
+	_, err = models.SyncPurchaseExperience(tx, purchase, nil, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("granting experience: %w", err)
+	}
+
+	err = models.SyncPurchaseInventory(tx, purchase, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("granting inventory items: %w", err)
+	}
+
+	_, err = achievements.Evaluate(tx, purchase.UserID, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("evaluating achievements: %w", err)
+	}
+
+	return purchase.UserID, nil
+}
+
+// purchasedItems returns the shop items bought with a checkout session, from
+// its line items
+func purchasedItems(sessionID string) ([]models.PurchaseItem, error) {
+	items := make([]models.PurchaseItem, 0)
+
+	lineItems, err := payments.ListLineItems(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("listing line items: %w", err)
+	}
+
+	for _, lineItem := range lineItems {
+		if lineItem.Price == nil {
+			continue
+		}
+
+		item, err := shop.ItemByStripePrice(lineItem.Price.ID)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error committing transaction: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return nil, fmt.Errorf("line item %s: %w", lineItem.ID, err)
 		}
+		items = append(items, item.PurchaseItem(lineItem.Quantity))
 	}
 
-	w.WriteHeader(http.StatusOK)
+	return items, nil
+}
+
+// handleChargeRefunded reverses the share of the experience of a purchase
+// which was refunded, and its inventory items once fully refunded
+func handleChargeRefunded(tx *sql.Tx, event stripe.Event) (string, error) {
+	var charge stripe.Charge
+	err := json.Unmarshal(event.Data.Raw, &charge)
+	if err != nil {
+		return "", fmt.Errorf("parsing webhook JSON: %w", err)
+	}
+
+	purchase, ok, err := fetchChargedPurchase(tx, charge.PaymentIntent)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	purchase.AmountRefunded = charge.AmountRefunded
+	if purchase.Status == models.PurchaseStatusPaid || purchase.Status == models.PurchaseStatusRefunded {
+		purchase.Status = settledStatus(purchase)
+	}
+
+	return purchase.UserID, updatePurchaseRefund(tx, purchase, "Refund of "+purchase.SessionID)
+}
+
+// handleDispute reverses the experience and inventory items of a disputed
+// purchase, granting them back if the dispute is won
+func handleDispute(tx *sql.Tx, event stripe.Event) (string, error) {
+	var dispute stripe.Dispute
+	err := json.Unmarshal(event.Data.Raw, &dispute)
+	if err != nil {
+		return "", fmt.Errorf("parsing webhook JSON: %w", err)
+	}
+
+	purchase, ok, err := fetchChargedPurchase(tx, dispute.PaymentIntent)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	switch {
+	case event.Type == stripe.EventTypeChargeDisputeCreated:
+		purchase.Status = models.PurchaseStatusDisputed
+	case dispute.Status == stripe.DisputeStatusWon:
+		purchase.Status = settledStatus(purchase)
+	case dispute.Status == stripe.DisputeStatusLost:
+		purchase.Status = models.PurchaseStatusChargedBack
+	default:
+		return "", nil
+	}
+
+	return purchase.UserID, updatePurchaseRefund(tx, purchase, "Dispute "+dispute.ID+" "+string(dispute.Status))
+}
+
+// fetchChargedPurchase returns the purchase paid by a payment intent, if any.
+// Charges which are not experience purchases are ignored.
+func fetchChargedPurchase(tx *sql.Tx, paymentIntent *stripe.PaymentIntent) (models.Purchase, bool, error) {
+	if paymentIntent == nil {
+		return models.Purchase{}, false, nil
+	}
+
+	purchase, err := models.FetchPurchaseByPaymentIntentID(tx, paymentIntent.ID)
+	if err == sql.ErrNoRows {
+		log.Printf("no purchase paid by %s", paymentIntent.ID)
+		return models.Purchase{}, false, nil
+	}
+	if err != nil {
+		return models.Purchase{}, false, fmt.Errorf("fetching purchase: %w", err)
+	}
+
+	// Refunds and disputes only concern purchases which were paid
+	if purchase.Status == models.PurchaseStatusPending || purchase.Status == models.PurchaseStatusFailed {
+		return models.Purchase{}, false, nil
+	}
+
+	return purchase, true, nil
+}
+
+// settledStatus returns the status of a purchase which is not disputed
+func settledStatus(purchase models.Purchase) models.PurchaseStatus {
+	if purchase.Amount > 0 && purchase.AmountRefunded >= purchase.Amount {
+		return models.PurchaseStatusRefunded
+	}
+	return models.PurchaseStatusPaid
+}
+
+func updatePurchaseRefund(tx *sql.Tx, purchase models.Purchase, note string) error {
+	err := models.UpdatePurchaseRefund(tx, purchase.PurchaseID, purchase.AmountRefunded, purchase.Status, time.Now())
+	if err != nil {
+		return fmt.Errorf("updating purchase: %w", err)
+	}
+
+	delta, err := models.SyncPurchaseExperience(tx, purchase, &note, time.Now())
+	if err != nil {
+		return fmt.Errorf("reversing experience: %w", err)
+	}
+	if delta != 0 {
+		log.Printf("experience of purchase %s adjusted by %d points", purchase.PurchaseID, delta)
+	}
+
+	err = models.SyncPurchaseInventory(tx, purchase, time.Now())
+	if err != nil {
+		return fmt.Errorf("reversing inventory items: %w", err)
+	}
+
+	return nil
+}
+
+// handleSubscription keeps the premium subscription of a user in sync with
+// Stripe
+func handleSubscription(tx *sql.Tx, event stripe.Event) (string, error) {
+	var sub stripe.Subscription
+	err := json.Unmarshal(event.Data.Raw, &sub)
+	if err != nil {
+		return "", fmt.Errorf("parsing webhook JSON: %w", err)
+	}
+
+	eventAt := time.Unix(event.Created, 0)
+
+	subscription, err := models.FetchSubscription(tx, sub.ID)
+	if err == sql.ErrNoRows {
+		user, err := subscriber(tx, sub)
+		if err != nil {
+			return "", fmt.Errorf("fetching user: %w", err)
+		}
+
+		subscription = models.Subscription{
+			SubscriptionID: sub.ID,
+			UserID:         user.UserID,
+			CreatedAt:      time.Unix(sub.Created, 0),
+		}
+		if sub.Customer != nil {
+			subscription.CustomerID = sub.Customer.ID
+			err = models.LinkStripeCustomer(tx, user.UserID, sub.Customer.ID)
+			if err != nil {
+				return "", fmt.Errorf("linking customer: %w", err)
+			}
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("fetching subscription: %w", err)
+	}
+
+	// Stripe does not guarantee the delivery order of events
+	if eventAt.Before(subscription.LastEventAt) {
+		log.Printf("skipping event %s older than the last one applied to subscription %s", event.ID, subscription.SubscriptionID)
+		return "", nil
+	}
+
+	subscription.Status = models.SubscriptionStatus(sub.Status)
+	subscription.CancelAtPeriodEnd = sub.CancelAtPeriodEnd
+	subscription.CurrentPeriodEnd = nil
+	if sub.Items != nil && len(sub.Items.Data) > 0 && sub.Items.Data[0].CurrentPeriodEnd != 0 {
+		periodEnd := time.Unix(sub.Items.Data[0].CurrentPeriodEnd, 0)
+		subscription.CurrentPeriodEnd = &periodEnd
+	}
+	subscription.UpdatedAt = time.Now()
+	subscription.LastEventAt = eventAt
+
+	log.Printf("subscription %s of user %s is %s", subscription.SubscriptionID, subscription.UserID, subscription.Status)
+	err = models.SaveSubscription(tx, subscription)
+	if err != nil {
+		return "", fmt.Errorf("saving subscription: %w", err)
+	}
+
+	return subscription.UserID, nil
+}
+
+// subscriber returns the user of a new subscription, from its metadata or
+// else from its customer
+func subscriber(tx *sql.Tx, sub stripe.Subscription) (models.User, error) {
+	if userID := sub.Metadata["userId"]; userID != "" {
+		return models.FetchOneUserByCloudIamSub(tx, userID)
+	}
+	if sub.Customer == nil {
+		return models.User{}, sql.ErrNoRows
+	}
+	return models.FetchOneUserByStripeCustomerID(tx, sub.Customer.ID)
+}
+
+// handleInvoicePaymentFailed marks the subscription of the invoice as past due,
+// Stripe retrying the payment before canceling it
+func handleInvoicePaymentFailed(tx *sql.Tx, event stripe.Event) (string, error) {
+	var invoice stripe.Invoice
+	err := json.Unmarshal(event.Data.Raw, &invoice)
+	if err != nil {
+		return "", fmt.Errorf("parsing webhook JSON: %w", err)
+	}
+
+	if invoice.Parent == nil || invoice.Parent.SubscriptionDetails == nil || invoice.Parent.SubscriptionDetails.Subscription == nil {
+		return "", nil
+	}
+	subscriptionID := invoice.Parent.SubscriptionDetails.Subscription.ID
+
+	subscription, err := models.FetchSubscription(tx, subscriptionID)
+	if err == sql.ErrNoRows {
+		log.Printf("no subscription %s", subscriptionID)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching subscription: %w", err)
+	}
+
+	if subscription.Status != models.SubscriptionStatusActive && subscription.Status != models.SubscriptionStatusTrialing {
+		return "", nil
+	}
+
+	log.Printf("payment of subscription %s failed", subscriptionID)
+	err = models.UpdateSubscriptionStatus(tx, subscriptionID, models.SubscriptionStatusPastDue, time.Unix(event.Created, 0), time.Now())
+	if err != nil {
+		return "", fmt.Errorf("updating subscription: %w", err)
+	}
+
+	return subscription.UserID, nil
+}
+
+// recordFailure records a failed event in its own transaction, the one
+// processing it being rolled back
+func recordFailure(event stripe.Event, cause error) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = models.RecordStripeEventFailure(tx, event.ID, string(event.Type), cause, time.Now())
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording failed event %s: %v\n", event.ID, err)
+	}
 }
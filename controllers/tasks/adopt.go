@@ -0,0 +1,83 @@
+package taskController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAdoptTask makes the user track a task from the public catalog
+func HandleAdoptTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user := principal.FromRequest(r)
+
+	task, err := models.FetchOneTask(tx, uuid, user.UserID)
+	if err == nil && !task.IsPublic && !task.Tracked {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !task.IsPublic {
+		http.Error(w, "Only public tasks can be adopted", http.StatusBadRequest)
+		return
+	}
+
+	err = models.AdoptTask(tx, user.UserID, task.TaskID)
+	if err == models.ErrTaskAlreadyTracked {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err = models.FetchOneTask(tx, task.TaskID, user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tasks := []models.Task{task}
+	if err := models.FetchTaskStates(tx, tasks, time.Now().In(user.Location())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(tasks[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
@@ -2,14 +2,18 @@ package taskController
 
 import (
 	"database/sql"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"server/achievements"
 	"server/common"
 	"server/models"
+	"server/principal"
+	"server/session"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
@@ -17,19 +21,24 @@ func HandleCompleteTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	uuid := vars["uuid"]
 
+	// The payload is optional, a task can be completed with an empty body
+	var payload completeTaskPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	tx, err := common.Db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer tx.Commit()
+	defer tx.Rollback()
 
-	fmt.Println("Fetching user")
-	userID, err := context.Get(r, "user").(jwt.MapClaims).GetSubject()
-	user, err := models.FetchOneUserByCloudIamSub(tx, userID)
+	user := principal.FromRequest(r)
 
-	fmt.Println("Fetching task")
-	task, err := models.FetchOneTask(tx, uuid)
+	task, err := models.FetchOneTask(tx, uuid, user.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -39,16 +48,51 @@ func HandleCompleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if task.UserID != nil && *task.UserID != user.UserID {
+	if !task.IsPublic && !task.Tracked {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	err = models.CompleteTask(tx, user.UserID, task.TaskID, time.Now())
+	completion := models.TaskCompletion{
+		CompletedAt: time.Now().In(user.Location()),
+		Note:        payload.Note,
+	}
+
+	progress, err := models.CompleteTask(tx, user.UserID, task.TaskID, completion)
+	if errors.Is(err, models.ErrTaskNotDue) || errors.Is(err, models.ErrTaskAlreadyCompleted) || errors.Is(err, models.ErrTaskArchived) || errors.Is(err, models.ErrTaskNotTracked) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unlocked, err := achievements.Evaluate(tx, user.UserID, completion.CompletedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The experience of the user changed
+	if err := session.Invalidate(user.UserID); err != nil {
+		log.Printf("Failed to invalidate the sessions of user %s: %v", user.UserID, err)
+	}
+
+	jsonData, err := json.Marshal(struct {
+		models.TaskProgress
+		Achievements []achievements.Achievement `json:"achievements"`
+	}{progress, unlocked})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
 }
@@ -0,0 +1,94 @@
+package taskController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func HandleGetTaskCompletions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+	query := r.URL.Query()
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Commit()
+
+	user := principal.FromRequest(r)
+
+	task, err := models.FetchOneTask(tx, uuid, user.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !task.IsPublic && !task.Tracked {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil || p < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		offset = (p - 1) * limit
+	}
+
+	// Dates are inclusive and interpreted in the timezone of the user
+	filter := models.TaskCompletionFilter{}
+
+	if completionTimeMin := query.Get("completionTimeMin"); completionTimeMin != "" {
+		completionTime, err := time.ParseInLocation("2006-01-02", completionTimeMin, user.Location())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.CompletionTimeMin = &completionTime
+	}
+
+	if completionTimeMax := query.Get("completionTimeMax"); completionTimeMax != "" {
+		completionTime, err := time.ParseInLocation("2006-01-02", completionTimeMax, user.Location())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		completionTime = completionTime.AddDate(0, 0, 1)
+		filter.CompletionTimeMax = &completionTime
+	}
+
+	completions, count, err := models.FetchTaskCompletions(tx, user.UserID, task.TaskID, filter, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(completions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"completions": %s, "current_page": %d, "max_page": %d}`, jsonData, offset/limit+1, (count-1)/limit+1)))
+}
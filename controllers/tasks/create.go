@@ -5,12 +5,15 @@ import (
 	"net/http"
 	"server/common"
 	"server/models"
+	"server/principal"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/gorilla/context"
 )
 
+// Users without a premium subscription can have this many custom tasks
+const freeCustomTaskLimit = 20
+
 func HandleCreateTask(w http.ResponseWriter, r *http.Request) {
 	body := r.Body
 
@@ -27,6 +30,17 @@ func HandleCreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := unit.ValidateQuantity(payload.Quantity); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	frequency, err := models.ParseFrequency(payload.Frequency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	tx, err := common.Db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -34,8 +48,25 @@ func HandleCreateTask(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Commit()
 
-	userID, err := context.Get(r, "user").(jwt.MapClaims).GetSubject()
-	user, err := models.FetchOneUserByCloudIamSub(tx, userID)
+	user := principal.FromRequest(r)
+
+	if !user.Premium {
+		count, err := models.CountOwnedTasks(tx, user.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count >= freeCustomTaskLimit {
+			http.Error(w, "Premium subscription required to create more tasks", http.StatusPaymentRequired)
+			return
+		}
+	}
+
+	// Anchor the recurrence on the day the task is created
+	if frequency.Start.IsZero() {
+		now := time.Now().In(user.Location())
+		frequency.Start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
 
 	task := models.Task{
 		TaskID:           uuid.New().String(),
@@ -43,17 +74,34 @@ func HandleCreateTask(w http.ResponseWriter, r *http.Request) {
 		Unit:             unit,
 		Name:             payload.Name,
 		Description:      payload.Description,
-		Frequency:        payload.Frequency,
+		Frequency:        frequency,
 		ExperienceGained: 100,
 		IsPublic:         false,
 		UserID:           &user.UserID,
 	}
 
+	if err := models.ValidateCategories(tx, user.UserID, payload.Categories); err != nil {
+		if err == models.ErrInvalidCategory {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = models.CreateTask(tx, task)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if len(payload.Categories) > 0 {
+		err = models.SetTaskCategories(tx, task.TaskID, payload.Categories)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
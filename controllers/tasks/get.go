@@ -7,16 +7,33 @@ import (
 	"net/http"
 	"server/common"
 	"server/models"
+	"server/principal"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
 func HandleGetTasks(w http.ResponseWriter, r *http.Request) {
+	filter := models.TaskFilter{}
+
+	if public := r.URL.Query().Get("public"); public != "" {
+		if publicBool, err := strconv.ParseBool(public); err == nil {
+			filter.Public = &publicBool
+		}
+	}
+
+	getTasks(w, r, filter)
+}
+
+// HandleGetCatalog lists the public tasks users can adopt
+func HandleGetCatalog(w http.ResponseWriter, r *http.Request) {
+	public := true
+	getTasks(w, r, models.TaskFilter{Public: &public})
+}
+
+func getTasks(w http.ResponseWriter, r *http.Request, filter models.TaskFilter) {
 	query := r.URL.Query()
 
 	tx, err := common.Db.Begin()
@@ -26,8 +43,7 @@ func HandleGetTasks(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Commit()
 
-	userID := context.Get(r, "user").(jwt.MapClaims)["sub"].(string)
-	user, err := models.FetchOneUserByCloudIamSub(tx, userID)
+	user := principal.FromRequest(r)
 
 	limit := 50
 	offset := 0
@@ -41,8 +57,6 @@ func HandleGetTasks(w http.ResponseWriter, r *http.Request) {
 		offset = (p - 1) * limit
 	}
 
-	filter := models.TaskFilter{}
-
 	if name := query.Get("name"); name != "" {
 		filter.Name = &name
 	}
@@ -53,9 +67,14 @@ func HandleGetTasks(w http.ResponseWriter, r *http.Request) {
 
 	if categories := query.Get("categories"); categories != "" {
 		filter.Categories = strings.Split(categories, ",")
+		if err := models.ValidateCategoryIDs(filter.Categories); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	filter.UserID = &user.UserID
+	filter.Now = time.Now().In(user.Location())
 
 	if completed := query.Get("completed"); completed != "" {
 		if completedBool, err := strconv.ParseBool(completed); err == nil {
@@ -63,22 +82,30 @@ func HandleGetTasks(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if archived := query.Get("archived"); archived != "" {
+		if archivedBool, err := strconv.ParseBool(archived); err == nil {
+			filter.Archived = &archivedBool
+		}
+	}
+
+	// Dates are inclusive and interpreted in the timezone of the user
 	if completionTimeMin := query.Get("completionTimeMin"); completionTimeMin != "" {
-		time, err := time.Parse("2006-01-02", completionTimeMin)
+		completionTime, err := time.ParseInLocation("2006-01-02", completionTimeMin, user.Location())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		filter.CompletionTimeMin = &time
+		filter.CompletionTimeMin = &completionTime
 	}
 
 	if completionTimeMax := query.Get("completionTimeMax"); completionTimeMax != "" {
-		time, err := time.Parse("2006-01-02", completionTimeMax)
+		completionTime, err := time.ParseInLocation("2006-01-02", completionTimeMax, user.Location())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		filter.CompletionTimeMax = &time
+		completionTime = completionTime.AddDate(0, 0, 1)
+		filter.CompletionTimeMax = &completionTime
 	}
 
 	sortBy := (*models.TaskSortBy)(nil)
@@ -118,8 +145,22 @@ func HandleGetTask(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Commit()
 
-	task, err := models.FetchOneTask(tx, uuid)
+	user := principal.FromRequest(r)
+
+	task, err := models.FetchOneTask(tx, uuid, user.UserID)
+	if err == nil && !task.IsPublic && !task.Tracked {
+		err = sql.ErrNoRows
+	}
 	if err == nil {
+		if task.Tracked {
+			tasks := []models.Task{task}
+			if err := models.FetchTaskStates(tx, tasks, time.Now().In(user.Location())); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			task = tasks[0]
+		}
+
 		jsonData, err := json.Marshal(task)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
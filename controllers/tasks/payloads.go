@@ -6,4 +6,15 @@ type createTaskPayload struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Frequency   string `json:"frequency"`
+	// Categories are category IDs, leaving them out keeps the current ones on update
+	Categories []string `json:"categories"`
+}
+
+type completeTaskPayload struct {
+	Note *string `json:"note"`
+}
+
+type logProgressPayload struct {
+	Quantity int     `json:"quantity"`
+	Note     *string `json:"note"`
 }
@@ -0,0 +1,106 @@
+package taskController
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"server/achievements"
+	"server/common"
+	"server/models"
+	"server/principal"
+	"server/session"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func HandleLogTaskProgress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+
+	var payload logProgressPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if payload.Quantity <= 0 {
+		http.Error(w, models.ErrInvalidQuantity.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user := principal.FromRequest(r)
+
+	task, err := models.FetchOneTask(tx, uuid, user.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !task.IsPublic && !task.Tracked {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	completion := models.TaskCompletion{
+		CompletedAt: time.Now().In(user.Location()),
+		Note:        payload.Note,
+		Quantity:    payload.Quantity,
+	}
+
+	progress, err := models.LogTaskProgress(tx, user.UserID, task.TaskID, completion)
+	if errors.Is(err, models.ErrInvalidQuantity) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrTaskNotDue) || errors.Is(err, models.ErrTaskAlreadyCompleted) || errors.Is(err, models.ErrTaskArchived) || errors.Is(err, models.ErrTaskNotTracked) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unlocked, err := achievements.Evaluate(tx, user.UserID, completion.CompletedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The experience of the user changed
+	if err := session.Invalidate(user.UserID); err != nil {
+		log.Printf("Failed to invalidate the sessions of user %s: %v", user.UserID, err)
+	}
+
+	jsonData, err := json.Marshal(struct {
+		models.TaskProgress
+		Achievements []achievements.Achievement `json:"achievements"`
+	}{progress, unlocked})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
@@ -6,9 +6,9 @@ import (
 	"net/http"
 	"server/common"
 	"server/models"
+	"server/principal"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
@@ -24,12 +24,7 @@ func HandleUpdateTask(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Commit()
 
-	userID, err := context.Get(r, "user").(jwt.MapClaims).GetSubject()
-	user, err := models.FetchOneUserByCloudIamSub(tx, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+	user := principal.FromRequest(r)
 
 	var payload createTaskPayload
 	err = json.NewDecoder(body).Decode(&payload)
@@ -38,7 +33,7 @@ func HandleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := models.FetchOneTask(tx, uuid)
+	task, err := models.FetchOneTask(tx, uuid, user.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -48,7 +43,8 @@ func HandleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if task.UserID != nil && *task.UserID != user.UserID {
+	// Public tasks have no owner and are managed through the admin endpoints
+	if task.UserID == nil || *task.UserID != user.UserID {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -59,23 +55,70 @@ func HandleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := unit.ValidateQuantity(payload.Quantity); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	frequency, err := models.ParseFrequency(payload.Frequency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keep the recurrence anchored on the same day, or on the day the rule
+	// changes for tasks created without an anchor
+	if frequency.Start.IsZero() {
+		frequency.Start = task.Frequency.Start
+	}
+	if frequency.Start.IsZero() && frequency.String() != task.Frequency.String() {
+		now := time.Now().In(user.Location())
+		frequency.Start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	frequencyChanged := frequency.String() != task.Frequency.String()
+
 	task = models.Task{
 		TaskID:           uuid,
 		Quantity:         payload.Quantity,
 		Unit:             unit,
 		Name:             payload.Name,
 		Description:      payload.Description,
-		Frequency:        payload.Frequency,
+		Frequency:        frequency,
 		ExperienceGained: 100,
 		IsPublic:         false,
 		UserID:           task.UserID,
 	}
 
+	if err := models.ValidateCategories(tx, user.UserID, payload.Categories); err != nil {
+		if err == models.ErrInvalidCategory {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = models.UpdateTask(tx, task)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if frequencyChanged {
+		err = models.ResetStreaks(tx, task.TaskID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if payload.Categories != nil {
+		err = models.SetTaskCategories(tx, task.TaskID, payload.Categories)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,287 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"server/common"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Methods are the signing methods accepted for access tokens
+var Methods = []string{"RS256", "RS384", "PS256", "ES256"}
+
+// A key missing from the JWKS triggers a refetch at most this often, so that
+// tokens with unknown key IDs cannot be used to flood Keycloak
+const minRefetchInterval = 30 * time.Second
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrKeyType    = errors.New("signing key does not match the token algorithm")
+)
+
+// jwk is a JSON Web Key, only RSA and P-256 keys being supported
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type key struct {
+	alg       string
+	publicKey interface{}
+}
+
+// KeySet is a JWKS fetched from a URL or read from a file, refreshed
+// periodically and whenever a token refers to a key it does not know
+type KeySet struct {
+	url             string
+	path            string
+	refreshInterval time.Duration
+
+	mutex     sync.Mutex
+	keys      map[string]key
+	fetchedAt time.Time
+	// refreshing is closed once the refresh in flight, if any, is done
+	refreshing chan struct{}
+}
+
+var keySet *KeySet
+
+// Init fetches the JWKS, if one is configured
+func Init() {
+	if common.Config.JwksURL == "" && common.Config.JwksPath == "" {
+		return
+	}
+
+	keySet = &KeySet{
+		url:             common.Config.JwksURL,
+		path:            common.Config.JwksPath,
+		refreshInterval: common.Config.JwksRefreshInterval,
+	}
+
+	// Keycloak may not be up yet, the keys are fetched again on the first token
+	if err := keySet.refresh(); err != nil {
+		log.Printf("Error fetching the JWKS: %v", err)
+	}
+}
+
+// Keyfunc returns the key verifying a token, selected by its kid header. Tokens
+// without kid or with a kid missing from the JWKS, or any token when no JWKS is
+// configured, are verified with the static public key.
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if keySet == nil || kid == "" {
+		return staticKey(token)
+	}
+
+	k, err := keySet.lookup(kid)
+	if errors.Is(err, ErrUnknownKey) {
+		return staticKey(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if k.alg != "" && k.alg != token.Method.Alg() {
+		return nil, ErrKeyType
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := k.publicKey.(*rsa.PublicKey); !ok {
+			return nil, ErrKeyType
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := k.publicKey.(*ecdsa.PublicKey); !ok {
+			return nil, ErrKeyType
+		}
+	default:
+		return nil, ErrKeyType
+	}
+
+	return k.publicKey, nil
+}
+
+// staticKey returns the public key read from PUBLIC_KEY_PATH, which is an RSA key
+func staticKey(token *jwt.Token) (interface{}, error) {
+	if common.PublicKey == nil {
+		return nil, ErrUnknownKey
+	}
+	if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+		return nil, ErrKeyType
+	}
+	return common.PublicKey, nil
+}
+
+func (s *KeySet) lookup(kid string) (key, error) {
+	s.mutex.Lock()
+	k, ok := s.keys[kid]
+	stale := time.Since(s.fetchedAt) > s.refreshInterval
+	canRefetch := time.Since(s.fetchedAt) > minRefetchInterval
+	s.mutex.Unlock()
+
+	if (ok && !stale) || (!ok && !canRefetch) {
+		if !ok {
+			return key{}, ErrUnknownKey
+		}
+		return k, nil
+	}
+
+	s.refreshOnce()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k, ok = s.keys[kid]
+	if !ok {
+		return key{}, ErrUnknownKey
+	}
+	return k, nil
+}
+
+// refreshOnce refreshes the keys, requests arriving while a refresh is in
+// flight waiting for it instead of fetching the JWKS again
+func (s *KeySet) refreshOnce() {
+	s.mutex.Lock()
+	done := s.refreshing
+	if done != nil {
+		s.mutex.Unlock()
+		<-done
+		return
+	}
+	done = make(chan struct{})
+	s.refreshing = done
+	s.mutex.Unlock()
+
+	// Keep using the keys known when the JWKS cannot be fetched
+	if err := s.refresh(); err != nil {
+		log.Printf("Error refreshing the JWKS: %v", err)
+	}
+
+	s.mutex.Lock()
+	s.refreshing = nil
+	s.mutex.Unlock()
+	close(done)
+}
+
+func (s *KeySet) refresh() error {
+	data, err := s.fetch()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Failures also count as fetches, to space out the retries
+	s.fetchedAt = time.Now()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parse(data)
+	if err != nil {
+		return err
+	}
+
+	s.keys = keys
+	return nil
+}
+
+func (s *KeySet) fetch() ([]byte, error) {
+	if s.path != "" {
+		return os.ReadFile(s.path)
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", s.url, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func parse(data []byte) (map[string]key, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]key)
+	for _, k := range document.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		publicKey, err := k.publicKey()
+		if err != nil {
+			// Keycloak also publishes keys of unsupported types, e.g. for encryption
+			continue
+		}
+		keys[k.Kid] = key{alg: k.Alg, publicKey: publicKey}
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, ErrKeyType
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrKeyType
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, ErrKeyType
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, ErrKeyType
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,150 @@
+package leaderboard
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"server/common"
+	"server/models"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Leaderboards are computed from the database and cached in Redis sorted sets
+// for a few minutes when Redis is configured
+const cacheTTL = 5 * time.Minute
+
+type Page struct {
+	Entries []models.LeaderboardEntry
+	// Me is the position of the user who requested the page, nil if not ranked
+	Me    *models.LeaderboardEntry
+	Total int
+}
+
+func cacheKey(period models.LeaderboardPeriod, now time.Time) string {
+	switch period {
+	case models.LeaderboardWeekly:
+		return "leaderboard:weekly:" + period.Start(now).Format("2006-01-02")
+	case models.LeaderboardMonthly:
+		return "leaderboard:monthly:" + period.Start(now).Format("2006-01")
+	}
+	return "leaderboard:global"
+}
+
+// Fetch returns a page of the current leaderboard of the given period, along
+// with the position of the user
+func Fetch(conn *sql.Tx, period models.LeaderboardPeriod, now time.Time, userID string, limit int, offset int) (Page, error) {
+	if common.Rdb != nil {
+		page, err := fetchCached(conn, period, now, userID, limit, offset)
+		if err == nil {
+			return page, nil
+		}
+		log.Printf("Failed to fetch the %s leaderboard from Redis, falling back to the database: %v", period, err)
+	}
+
+	since := period.Start(now)
+	entries, total, err := models.FetchLeaderboard(conn, period, since, limit, offset)
+	if err != nil {
+		return Page{}, err
+	}
+
+	me, err := models.FetchLeaderboardEntry(conn, period, since, userID)
+	if err != nil {
+		return Page{}, err
+	}
+
+	return Page{Entries: entries, Me: me, Total: total}, nil
+}
+
+func fetchCached(conn *sql.Tx, period models.LeaderboardPeriod, now time.Time, userID string, limit int, offset int) (Page, error) {
+	key := cacheKey(period, now)
+
+	exists, err := common.Rdb.Exists(common.Ctx, key).Result()
+	if err != nil {
+		return Page{}, err
+	}
+
+	if exists == 0 {
+		if err := buildCache(conn, period, now, key); err != nil {
+			return Page{}, err
+		}
+	}
+
+	scores, err := common.Rdb.ZRevRangeWithScores(common.Ctx, key, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Entries: make([]models.LeaderboardEntry, len(scores))}
+	for i, score := range scores {
+		page.Entries[i] = models.LeaderboardEntry{
+			Position: offset + i + 1,
+			UserID:   score.Member.(string),
+			Score:    score.Score,
+		}
+	}
+
+	total, err := common.Rdb.ZCard(common.Ctx, key).Result()
+	if err != nil {
+		return Page{}, err
+	}
+	page.Total = int(total)
+
+	position, err := common.Rdb.ZRevRank(common.Ctx, key, userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return page, nil
+	}
+	if err != nil {
+		return Page{}, err
+	}
+
+	score, err := common.Rdb.ZScore(common.Ctx, key, userID).Result()
+	if err != nil {
+		return Page{}, err
+	}
+
+	page.Me = &models.LeaderboardEntry{Position: int(position) + 1, UserID: userID, Score: score}
+	return page, nil
+}
+
+// buildCache fills the sorted set of a leaderboard from the database. It is
+// built under a temporary key so that readers never see a partial leaderboard.
+func buildCache(conn *sql.Tx, period models.LeaderboardPeriod, now time.Time, key string) error {
+	entries, err := models.FetchAllLeaderboardEntries(conn, period, period.Start(now))
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	members := make([]redis.Z, len(entries))
+	for i, entry := range entries {
+		members[i] = redis.Z{Score: entry.Score, Member: entry.UserID}
+	}
+
+	tmpKey := key + ":building"
+	pipe := common.Rdb.TxPipeline()
+	pipe.Del(common.Ctx, tmpKey)
+	pipe.ZAdd(common.Ctx, tmpKey, members...)
+	pipe.Expire(common.Ctx, tmpKey, cacheTTL)
+	pipe.Rename(common.Ctx, tmpKey, key)
+	_, err = pipe.Exec(common.Ctx)
+	return err
+}
+
+// Invalidate drops the cached leaderboards, for instance when a user opts out of them
+func Invalidate() error {
+	if common.Rdb == nil {
+		return nil
+	}
+
+	now := time.Now()
+	return common.Rdb.Del(common.Ctx,
+		cacheKey(models.LeaderboardGlobal, now),
+		cacheKey(models.LeaderboardWeekly, now),
+		cacheKey(models.LeaderboardMonthly, now),
+	).Err()
+}
@@ -0,0 +1,118 @@
+package leveling
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidCurve = errors.New("invalid level curve")
+)
+
+// Curve describes how much experience each level costs
+type Curve interface {
+	// Cost returns the experience needed to go from level to level+1, at least 1
+	Cost(level int) int64
+}
+
+// Linear is a curve where each level costs Increment more than the previous
+// one, starting from Base for both the levels 0 and 1
+type Linear struct {
+	Base      int64
+	Increment int64
+}
+
+func (c Linear) Cost(level int) int64 {
+	return max(c.Base+c.Increment*int64(max(level-1, 0)), 1)
+}
+
+// Exponential is a curve where each level costs Factor times the previous one,
+// starting from Base for the level 0
+type Exponential struct {
+	Base   int64
+	Factor float64
+}
+
+func (c Exponential) Cost(level int) int64 {
+	cost := float64(c.Base) * math.Pow(c.Factor, float64(level))
+	if cost >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return max(int64(math.Round(cost)), 1)
+}
+
+// Table is a curve given by the total experience needed to reach each level,
+// starting with 0 for the level 0. Past the end of the table, levels keep
+// costing as much as the last one.
+type Table []int64
+
+func (c Table) Cost(level int) int64 {
+	if level+1 < len(c) {
+		return c[level+1] - c[level]
+	}
+	return c[len(c)-1] - c[len(c)-2]
+}
+
+// ParseTable parses a comma separated list of increasing experience thresholds
+func ParseTable(s string) (Table, error) {
+	table := make(Table, 0)
+	for _, part := range strings.Split(s, ",") {
+		threshold, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCurve
+		}
+		if len(table) > 0 && threshold <= table[len(table)-1] {
+			return nil, ErrInvalidCurve
+		}
+		table = append(table, threshold)
+	}
+
+	if len(table) < 2 || table[0] != 0 {
+		return nil, ErrInvalidCurve
+	}
+
+	return table, nil
+}
+
+// NewCurve builds a curve from its configuration. The base defaults to 1000
+// experience points and the factor is the increment of a linear curve or the
+// ratio of an exponential one.
+func NewCurve(kind string, base string, factor string, table string) (Curve, error) {
+	baseXP := int64(1000)
+	if base != "" {
+		var err error
+		baseXP, err = strconv.ParseInt(base, 10, 64)
+		if err != nil || baseXP < 1 {
+			return nil, ErrInvalidCurve
+		}
+	}
+
+	switch strings.ToLower(kind) {
+	case "", "linear":
+		increment := baseXP
+		if factor != "" {
+			var err error
+			increment, err = strconv.ParseInt(factor, 10, 64)
+			if err != nil || increment < 0 {
+				return nil, ErrInvalidCurve
+			}
+		}
+		return Linear{Base: baseXP, Increment: increment}, nil
+	case "exponential":
+		ratio := 1.5
+		if factor != "" {
+			var err error
+			ratio, err = strconv.ParseFloat(factor, 64)
+			if err != nil || ratio < 1 || math.IsInf(ratio, 0) {
+				return nil, ErrInvalidCurve
+			}
+		}
+		return Exponential{Base: baseXP, Factor: ratio}, nil
+	case "table":
+		return ParseTable(table)
+	}
+
+	return nil, ErrInvalidCurve
+}
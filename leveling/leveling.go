@@ -0,0 +1,79 @@
+package leveling
+
+import (
+	"server/common"
+)
+
+// maxLevel bounds the levels computed, so that a flat curve cannot make
+// conversions loop for too long
+const maxLevel = 100000
+
+var curve Curve = Linear{Base: 1000, Increment: 1000}
+
+// Init sets the curve from the LEVEL_* configuration
+func Init() error {
+	c, err := NewCurve(common.Config.LevelCurve, common.Config.LevelBaseXP, common.Config.LevelFactor, common.Config.LevelTable)
+	if err != nil {
+		return err
+	}
+	curve = c
+	return nil
+}
+
+// SetCurve replaces the curve used for the conversions
+func SetCurve(c Curve) {
+	curve = c
+}
+
+// Progress is the level reached with some total experience and the progress
+// towards the next one
+type Progress struct {
+	Level int `json:"level"`
+	// Experience is the experience earned since the current level was reached
+	Experience int64 `json:"level_experience"`
+	// Next is the experience needed to go from the current level to the next one
+	Next int64 `json:"next_level_experience"`
+}
+
+// Remaining returns the experience still needed to reach the next level
+func (p Progress) Remaining() int64 {
+	return p.Next - p.Experience
+}
+
+// ProgressOf converts a total experience to a level and progress
+func ProgressOf(experience int64) Progress {
+	experience = max(experience, 0)
+
+	level := 0
+	for level < maxLevel {
+		cost := curve.Cost(level)
+		if experience < cost {
+			return Progress{Level: level, Experience: experience, Next: cost}
+		}
+		experience -= cost
+		level++
+	}
+
+	return Progress{Level: level, Experience: experience, Next: curve.Cost(level)}
+}
+
+// Level returns the level reached with some total experience
+func Level(experience int64) int {
+	return ProgressOf(experience).Level
+}
+
+// Rank returns the level as a decimal, its fractional part being the progress
+// towards the next level
+func Rank(experience int64) float32 {
+	progress := ProgressOf(experience)
+	return float32(progress.Level) + float32(progress.Experience)/float32(progress.Next)
+}
+
+// ExperienceFor returns the total experience needed to reach a level
+func ExperienceFor(level int) int64 {
+	total := int64(0)
+	for l := 0; l < min(level, maxLevel); l++ {
+		total += curve.Cost(l)
+	}
+	return total
+}
@@ -0,0 +1,92 @@
+package leveling
+
+import (
+	"testing"
+)
+
+// defaultCurve is the curve used without LEVEL_* configuration
+var defaultCurve = Linear{Base: 1000, Increment: 1000}
+
+func TestLevel(t *testing.T) {
+	SetCurve(defaultCurve)
+
+	tests := []struct {
+		experience int64
+		want       int
+	}{
+		{-10, 0},
+		{0, 0},
+		{999, 0},
+		{1000, 1},
+		{1999, 1},
+		{2000, 2},
+		{3999, 2},
+		{4000, 3},
+		{7000, 4},
+	}
+
+	for _, test := range tests {
+		if got := Level(test.experience); got != test.want {
+			t.Errorf("Level(%d) = %d, want %d", test.experience, got, test.want)
+		}
+	}
+}
+
+func TestProgressOf(t *testing.T) {
+	SetCurve(defaultCurve)
+
+	tests := []struct {
+		experience int64
+		want       Progress
+	}{
+		{0, Progress{Level: 0, Experience: 0, Next: 1000}},
+		{999, Progress{Level: 0, Experience: 999, Next: 1000}},
+		{1000, Progress{Level: 1, Experience: 0, Next: 1000}},
+		{1500, Progress{Level: 1, Experience: 500, Next: 1000}},
+		{2000, Progress{Level: 2, Experience: 0, Next: 2000}},
+		{4000, Progress{Level: 3, Experience: 0, Next: 3000}},
+	}
+
+	for _, test := range tests {
+		if got := ProgressOf(test.experience); got != test.want {
+			t.Errorf("ProgressOf(%d) = %+v, want %+v", test.experience, got, test.want)
+		}
+	}
+
+	if got := Rank(1500); got != 1.5 {
+		t.Errorf("Rank(1500) = %v, want 1.5", got)
+	}
+}
+
+// The default curve must match the opening balances of migration 009, where
+// reaching the level n >= 1 takes 1000 + 500 * n * (n - 1) experience points
+func TestDefaultCurveMatchesOpeningBalances(t *testing.T) {
+	SetCurve(defaultCurve)
+
+	for level := 1; level <= 100; level++ {
+		want := int64(1000 + 500*level*(level-1))
+		if got := ExperienceFor(level); got != want {
+			t.Fatalf("ExperienceFor(%d) = %d, want %d", level, got, want)
+		}
+		if got := Level(want); got != level {
+			t.Fatalf("Level(%d) = %d, want %d", want, got, level)
+		}
+		if got := Level(want - 1); got != level-1 {
+			t.Fatalf("Level(%d) = %d, want %d", want-1, got, level-1)
+		}
+	}
+}
+
+func TestMaxLevel(t *testing.T) {
+	SetCurve(Linear{Base: 1, Increment: 0})
+	defer SetCurve(defaultCurve)
+
+	progress := ProgressOf(maxLevel + 500)
+	if progress.Level != maxLevel || progress.Experience != 500 {
+		t.Errorf("ProgressOf(%d) = %+v, want the level %d and 500 experience", maxLevel+500, progress, maxLevel)
+	}
+
+	if got, want := ExperienceFor(maxLevel+10), ExperienceFor(maxLevel); got != want {
+		t.Errorf("ExperienceFor(%d) = %d, want %d", maxLevel+10, got, want)
+	}
+}
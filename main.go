@@ -3,32 +3,107 @@ package main
 import (
 	"log"
 	"net/http"
+	"server/achievements"
+	"server/common"
+	"server/controllers/admin"
 	"server/controllers/auth"
+	"server/controllers/categories"
+	"server/controllers/dev"
+	"server/controllers/leaderboard"
+	"server/controllers/me"
+	"server/controllers/shop"
 	"server/controllers/stripe"
 	stripeCheckoutController "server/controllers/stripe/checkout"
+	stripePortalController "server/controllers/stripe/portal"
 	"server/controllers/tasks"
+	"server/jwks"
+	"server/leveling"
 	"server/middlewares"
+	"server/models"
+	"server/payments"
+	"server/shop"
+	_ "time/tzdata"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	common.Init()
+	if err := leveling.Init(); err != nil {
+		log.Fatalf("invalid LEVEL_* configuration: %v", err)
+	}
+	if err := achievements.Load(common.Config.AchievementsPath); err != nil {
+		log.Fatalf("invalid achievements: %v", err)
+	}
+	if err := shop.Load(common.Config.ShopItemsPath); err != nil {
+		log.Fatalf("invalid shop items: %v", err)
+	}
+	jwks.Init()
+	payments.Init()
+
 	r := mux.NewRouter()
 
 	r.Use(middlewares.Cors)
 
-	r.HandleFunc("/api/v1/auth/me", middlewares.Auth(authController.HandleGet)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/auth/me", middlewares.AuthScope(models.ScopeProfileRead)(authController.HandleGet)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/auth/me", middlewares.Auth(authController.HandleUpdate)).Methods("PUT", "OPTIONS")
+
+	r.HandleFunc("/api/v1/me/experience", middlewares.AuthScope(models.ScopeProfileRead)(meController.HandleGetExperience)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/me/achievements", middlewares.AuthScope(models.ScopeProfileRead)(meController.HandleGetAchievements)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/me/purchases", middlewares.AuthScope(models.ScopeProfileRead)(meController.HandleGetPurchases)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/me/inventory", middlewares.AuthScope(models.ScopeProfileRead)(meController.HandleGetInventory)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/me/stats", middlewares.AuthScope(models.ScopeProfileRead)(middlewares.Premium(meController.HandleGetStats))).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/me/tokens", middlewares.Auth(meController.HandleGetAccessTokens)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/me/tokens", middlewares.Auth(meController.HandleCreateAccessToken)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/me/tokens/{uuid}", middlewares.Auth(meController.HandleRevokeAccessToken)).Methods("DELETE", "OPTIONS")
+
+	r.HandleFunc("/api/v1/tasks", middlewares.AuthScope(models.ScopeTasksRead)(taskController.HandleGetTasks)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/catalog", middlewares.AuthScope(models.ScopeTasksRead)(taskController.HandleGetCatalog)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}", middlewares.AuthScope(models.ScopeTasksRead)(taskController.HandleGetTask)).Methods("GET", "OPTIONS")
+
+	r.HandleFunc("/api/v1/tasks", middlewares.AuthScope(models.ScopeTasksWrite)(taskController.HandleCreateTask)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}", middlewares.AuthScope(models.ScopeTasksWrite)(taskController.HandleUpdateTask)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}", middlewares.AuthScope(models.ScopeTasksWrite)(taskController.HandleDeleteTask)).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}/restore", middlewares.AuthScope(models.ScopeTasksWrite)(taskController.HandleRestoreTask)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}/adopt", middlewares.AuthScope(models.ScopeTasksWrite)(taskController.HandleAdoptTask)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}/complete", middlewares.AuthScope(models.ScopeTasksComplete)(taskController.HandleCompleteTask)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}/progress", middlewares.AuthScope(models.ScopeTasksComplete)(taskController.HandleLogTaskProgress)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/tasks/{uuid}/completions", middlewares.AuthScope(models.ScopeTasksRead)(taskController.HandleGetTaskCompletions)).Methods("GET", "OPTIONS")
 
-	r.HandleFunc("/api/v1/tasks", middlewares.Auth(taskController.HandleGetTasks)).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/v1/tasks/{uuid}", middlewares.Auth(taskController.HandleGetTask)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/categories", middlewares.AuthScope(models.ScopeTasksRead)(categoryController.HandleGetCategories)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/categories/{uuid}", middlewares.AuthScope(models.ScopeTasksRead)(categoryController.HandleGetCategory)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/categories", middlewares.AuthScope(models.ScopeTasksWrite)(categoryController.HandleCreateCategory)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/categories/{uuid}", middlewares.AuthScope(models.ScopeTasksWrite)(categoryController.HandleUpdateCategory)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/v1/categories/{uuid}", middlewares.AuthScope(models.ScopeTasksWrite)(categoryController.HandleDeleteCategory)).Methods("DELETE", "OPTIONS")
 
-	r.HandleFunc("/api/v1/tasks", middlewares.Auth(taskController.HandleCreateTask)).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/v1/tasks/{uuid}", middlewares.Auth(taskController.HandleUpdateTask)).Methods("PUT", "OPTIONS")
-	r.HandleFunc("/api/v1/tasks/{uuid}/complete", middlewares.Auth(taskController.HandleCompleteTask)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/v1/leaderboard", middlewares.AuthScope(models.ScopeProfileRead)(leaderboardController.HandleGetLeaderboard)).Methods("GET", "OPTIONS")
+
+	r.HandleFunc("/api/v1/admin/stripe/events", middlewares.Auth(middlewares.Admin(adminController.HandleGetStripeEvents))).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/tasks", middlewares.Auth(middlewares.Admin(adminController.HandleCreatePublicTask))).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/tasks/{uuid}", middlewares.Auth(middlewares.Admin(adminController.HandleUpdatePublicTask))).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/tasks/{uuid}", middlewares.Auth(middlewares.Admin(adminController.HandleUnpublishTask))).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/categories", middlewares.Auth(middlewares.Admin(adminController.HandleCreateCategory))).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/categories/{uuid}", middlewares.Auth(middlewares.Admin(adminController.HandleUpdateCategory))).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/categories/{uuid}", middlewares.Auth(middlewares.Admin(adminController.HandleDeleteCategory))).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/v1/admin/users/{uuid}/experience", middlewares.Auth(middlewares.Admin(adminController.HandleAdjustExperience))).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/shop/items", middlewares.Auth(shopController.HandleGetItems)).Methods("GET", "OPTIONS")
 
 	r.HandleFunc("/api/v1/stripe/webhook", stripeController.HandleWebhook)
 	r.HandleFunc("/api/v1/stripe/checkout/create", middlewares.Auth(stripeCheckoutController.HandleExperienceCheckout)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/stripe/checkout/subscription", middlewares.Auth(stripeCheckoutController.HandleSubscriptionCheckout)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/v1/stripe/portal", middlewares.Auth(stripePortalController.HandleCreatePortalSession)).Methods("POST", "OPTIONS")
+
+	// The fake payments provider is driven through these endpoints, which
+	// do not exist when payments go through Stripe
+	if payments.Fake() != nil {
+		r.HandleFunc("/api/v1/dev/payments/checkout/{id}", devController.HandleGetCheckout).Methods("GET")
+		r.HandleFunc("/api/v1/dev/payments/checkout/{id}/complete", devController.HandleCompleteCheckout).Methods("POST")
+		r.HandleFunc("/api/v1/dev/payments/checkout/{id}/cancel", devController.HandleCancelCheckout).Methods("POST")
+		r.HandleFunc("/api/v1/dev/payments/checkout/{id}/refund", devController.HandleRefundCheckout).Methods("POST")
+		log.Printf("Using the fake payments provider")
+	}
 
 	log.Printf("Server starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", r))
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+	"server/principal"
+)
+
+// AdminRole is the Keycloak role granting access to the admin endpoints
+const AdminRole = "admin"
+
+// RequireRole only lets through the users having one of the given roles,
+// either realm roles or roles on the client of the backend. It must be
+// wrapped by Auth.
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !principal.FromRequest(r).HasRole(roles...) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		})
+	}
+}
+
+// Admin only lets through the users having the admin role. It must be wrapped
+// by Auth.
+func Admin(next http.HandlerFunc) http.HandlerFunc {
+	return RequireRole(AdminRole)(next)
+}
@@ -2,110 +2,237 @@ package middlewares
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"server/common"
+	"server/jwks"
 	"server/models"
+	"server/principal"
+	"server/session"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/gorilla/context"
 	_ "github.com/lib/pq"
 )
 
+var errInvalidAuthorizedParty = errors.New("token has invalid authorized party")
+
+// Auth authenticates the requests made with a Keycloak access token.
+// Personal access tokens are refused, see AuthScope.
 func Auth(next http.HandlerFunc) http.HandlerFunc {
+	return authenticate("", next)
+}
+
+// AuthScope authenticates the requests made with a Keycloak access token or
+// with a personal access token granted the scope
+func AuthScope(scope models.AccessTokenScope) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return authenticate(scope, next)
+	}
+}
+
+func authenticate(scope models.AccessTokenScope, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		bearer := r.Header.Get("Authorization")
 		if !strings.HasPrefix(bearer, "Bearer ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			unauthorized(w, "", "")
 			return
 		}
 
 		accessToken := bearer[7:]
 
-		if common.Rdb != nil {
-			exists, err := common.Rdb.Exists(common.Ctx, "user:"+accessToken).Result()
+		if strings.HasPrefix(accessToken, models.AccessTokenPrefix) {
+			p, err := authenticateAccessToken(accessToken)
+			if err == sql.ErrNoRows {
+				unauthorized(w, "invalid_token", "The personal access token is invalid, expired or revoked")
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			if exists == 1 {
-				user := models.User{}
-				common.Rdb.Get(common.Ctx, "user:"+accessToken).Scan(&user)
-
-				context.Set(r, "user", user)
-
-				next(w, r)
+			if scope == "" || !p.HasScope(scope) {
+				insufficientScope(w, scope)
 				return
 			}
-		}
-
-		token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return common.PublicKey, nil
-		})
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			next.ServeHTTP(w, r.WithContext(principal.NewContext(r.Context(), p)))
 			return
 		}
 
-		context.Set(r, "user", token.Claims)
-
-		tx, err := common.Db.Begin()
+		userSession, ok, err := session.Get(accessToken)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			log.Printf("Failed to fetch the session from Redis: %v", err)
 		}
 
-		sub, err := token.Claims.(jwt.MapClaims).GetSubject()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		user, err := models.FetchOneUserByCloudIamSub(tx, sub)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				user = models.User{
-					UserID:      uuid.New().String(),
-					CloudIamSub: token.Claims.(jwt.MapClaims)["sub"].(string),
-					Rank:        0,
-				}
-
-				if err := models.CreateUser(tx, user); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !ok {
+			token, err := parseAccessToken(accessToken)
+			if err != nil {
+				unauthorized(w, "invalid_token", describeTokenError(err))
 				return
 			}
-		}
-
-		if err := tx.Commit(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
 
-		if common.Rdb != nil {
-			present, err := common.Rdb.Exists(common.Ctx, "user:"+user.CloudIamSub).Result()
+			claims := token.Claims.(jwt.MapClaims)
+			user, err := provisionUser(claims)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			if present == 0 {
-				err = common.Rdb.Set(common.Ctx, "user:"+user.CloudIamSub, user, 0).Err()
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
+			// Expiration is required by parseAccessToken
+			expiresAt, _ := claims.GetExpirationTime()
+			userSession = session.Session{Principal: principal.New(user, claims), ExpiresAt: expiresAt.Time}
+			if err := session.Save(accessToken, userSession); err != nil {
+				log.Printf("Failed to cache the session in Redis: %v", err)
 			}
 		}
-		next.ServeHTTP(w, r)
+
+		next.ServeHTTP(w, r.WithContext(principal.NewContext(r.Context(), userSession.Principal)))
 	})
 }
+
+// authenticateAccessToken returns the principal of a personal access token,
+// recording its use. Personal access tokens are not cached, so that revoking
+// them takes effect immediately.
+func authenticateAccessToken(secret string) (principal.Principal, error) {
+	tx, err := common.Db.Begin()
+	if err != nil {
+		return principal.Principal{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	token, err := models.FetchActiveAccessToken(tx, secret, now)
+	if err != nil {
+		return principal.Principal{}, err
+	}
+
+	user, err := models.FetchOneUser(tx, token.UserID)
+	if err != nil {
+		return principal.Principal{}, err
+	}
+
+	if err := models.TouchAccessToken(tx, token.TokenID, now); err != nil {
+		return principal.Principal{}, err
+	}
+
+	return principal.FromAccessToken(user, token), tx.Commit()
+}
+
+// provisionUser returns the user authenticated by the claims, creating them
+// on their first request
+func provisionUser(claims jwt.MapClaims) (models.User, error) {
+	sub, err := claims.GetSubject()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	tx, err := common.Db.Begin()
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	user, err := models.FetchOneUserByCloudIamSub(tx, sub)
+	if err == sql.ErrNoRows {
+		err = models.CreateUser(tx, models.User{
+			UserID:      uuid.New().String(),
+			CloudIamSub: sub,
+		})
+		if err == nil {
+			user, err = models.FetchOneUserByCloudIamSub(tx, sub)
+		}
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+// parseAccessToken verifies the signature and the claims of an access token:
+// it must not be expired, have a subject, and match the configured issuer,
+// audience and authorized party
+func parseAccessToken(accessToken string) (*jwt.Token, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwks.Methods),
+		jwt.WithLeeway(common.Config.JwtLeeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if common.Config.JwtIssuer != "" {
+		options = append(options, jwt.WithIssuer(common.Config.JwtIssuer))
+	}
+	if common.Config.JwtAudience != "" {
+		options = append(options, jwt.WithAudience(common.Config.JwtAudience))
+	}
+
+	token, err := jwt.Parse(accessToken, jwks.Keyfunc, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if sub, err := claims.GetSubject(); err != nil || sub == "" {
+		return nil, jwt.ErrTokenRequiredClaimMissing
+	}
+
+	if common.Config.JwtAuthorizedParty != "" {
+		if azp, _ := claims["azp"].(string); azp != common.Config.JwtAuthorizedParty {
+			return nil, errInvalidAuthorizedParty
+		}
+	}
+
+	return token, nil
+}
+
+func describeTokenError(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "The access token is malformed"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return "The access token signature is invalid"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "The access token expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "The access token is not valid yet"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "The access token was issued by another issuer"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "The access token is meant for another audience"
+	case errors.Is(err, errInvalidAuthorizedParty):
+		return "The access token was issued to another client"
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return "The access token lacks a required claim"
+	}
+	return "The access token is invalid"
+}
+
+// insufficientScope answers 403 to the personal access tokens lacking the
+// scope of a route, or used on a route accepting none
+func insufficientScope(w http.ResponseWriter, scope models.AccessTokenScope) {
+	challenge := `Bearer realm="hobbit", error="insufficient_scope"`
+	if scope != "" {
+		challenge += fmt.Sprintf(`, scope="%s"`, scope)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// unauthorized answers 401 with a WWW-Authenticate header as described by
+// RFC 6750, the error being empty when no token was given
+func unauthorized(w http.ResponseWriter, code string, description string) {
+	challenge := `Bearer realm="hobbit"`
+	if code != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, code, description)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
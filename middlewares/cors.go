@@ -7,6 +7,7 @@ func Cors(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
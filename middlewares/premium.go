@@ -0,0 +1,19 @@
+package middlewares
+
+import (
+	"net/http"
+	"server/principal"
+)
+
+// Premium only lets through the users having a Hobbit Premium subscription.
+// It must be wrapped by Auth.
+func Premium(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !principal.FromRequest(r).Premium {
+			http.Error(w, "Premium subscription required", http.StatusPaymentRequired)
+			return
+		}
+
+		next(w, r)
+	})
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AccessTokenPrefix starts every personal access token, telling them apart
+// from Keycloak tokens
+const AccessTokenPrefix = "hbt_"
+
+// Number of characters of a token kept to tell tokens apart, prefix included
+const accessTokenDisplayLength = 12
+
+type AccessTokenScope string
+
+const (
+	ScopeTasksRead     AccessTokenScope = "tasks:read"
+	ScopeTasksWrite    AccessTokenScope = "tasks:write"
+	ScopeTasksComplete AccessTokenScope = "tasks:complete"
+	ScopeProfileRead   AccessTokenScope = "profile:read"
+)
+
+var accessTokenScopes = []AccessTokenScope{ScopeTasksRead, ScopeTasksWrite, ScopeTasksComplete, ScopeProfileRead}
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+func AccessTokenScopeFromString(s string) (AccessTokenScope, error) {
+	for _, scope := range accessTokenScopes {
+		if string(scope) == s {
+			return scope, nil
+		}
+	}
+	return "", ErrInvalidScope
+}
+
+// AccessToken is a personal access token, letting scripts act on behalf of a
+// user within its scopes. Only the hash of the token is stored.
+type AccessToken struct {
+	TokenID string `json:"id"`
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	// Prefix is the beginning of the token
+	Prefix     string             `json:"prefix"`
+	Scopes     []AccessTokenScope `json:"scopes"`
+	CreatedAt  time.Time          `json:"created_at"`
+	LastUsedAt *time.Time         `json:"last_used_at"`
+	ExpiresAt  *time.Time         `json:"expires_at"`
+}
+
+// GenerateAccessToken returns a new random token
+func GenerateAccessToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func HashAccessToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+const selectAccessToken = "select token_id, user_id, name, prefix, scopes, created_at, last_used_at, expires_at from access_token"
+
+func scanAccessToken(row scanner) (AccessToken, error) {
+	var token AccessToken
+	var scopes []string
+	err := row.Scan(&token.TokenID, &token.UserID, &token.Name, &token.Prefix, pq.Array(&scopes), &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt)
+	token.Scopes = make([]AccessTokenScope, len(scopes))
+	for i, scope := range scopes {
+		token.Scopes[i] = AccessTokenScope(scope)
+	}
+	return token, err
+}
+
+// CreateAccessToken stores the hash of a new token of a user
+func CreateAccessToken(conn *sql.Tx, token AccessToken, secret string) (AccessToken, error) {
+	if token.TokenID == "" {
+		token.TokenID = uuid.New().String()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	token.Prefix = secret[:min(accessTokenDisplayLength, len(secret))]
+
+	scopes := make([]string, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	var expiresAt *time.Time
+	if token.ExpiresAt != nil {
+		utc := token.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	_, err := conn.Exec("insert into access_token (token_id, user_id, name, prefix, token_hash, scopes, created_at, expires_at) values ($1, $2, $3, $4, $5, $6, $7, $8)",
+		token.TokenID, token.UserID, token.Name, token.Prefix, HashAccessToken(secret), pq.Array(scopes), token.CreatedAt.UTC(), expiresAt)
+	return token, err
+}
+
+// FetchAccessTokens returns the tokens of a user which are not revoked, the
+// expired ones included
+func FetchAccessTokens(conn *sql.Tx, userID string) ([]AccessToken, error) {
+	tokens := make([]AccessToken, 0)
+
+	rows, err := conn.Query(selectAccessToken+" where user_id = $1 and revoked_at is null order by created_at desc, token_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// FetchActiveAccessToken returns the token matching a secret, unless it was
+// revoked or has expired
+func FetchActiveAccessToken(conn *sql.Tx, secret string, at time.Time) (AccessToken, error) {
+	return scanAccessToken(conn.QueryRow(selectAccessToken+" where token_hash = $1 and revoked_at is null and (expires_at is null or expires_at > $2)", HashAccessToken(secret), at.UTC()))
+}
+
+// CountActiveAccessTokens returns the number of tokens of a user which are
+// neither revoked nor expired
+func CountActiveAccessTokens(conn *sql.Tx, userID string, at time.Time) (int, error) {
+	var count int
+	err := conn.QueryRow("select count(*) from access_token where user_id = $1 and revoked_at is null and (expires_at is null or expires_at > $2)", userID, at.UTC()).Scan(&count)
+	return count, err
+}
+
+// TouchAccessToken records the use of a token, at most once a minute to spare
+// a write per request
+func TouchAccessToken(conn *sql.Tx, tokenID string, at time.Time) error {
+	_, err := conn.Exec("update access_token set last_used_at = $2 where token_id = $1 and (last_used_at is null or last_used_at < $2::timestamp - interval '1 minute')", tokenID, at.UTC())
+	return err
+}
+
+// RevokeAccessToken revokes a token of a user, returning false if they have
+// no such token
+func RevokeAccessToken(conn *sql.Tx, userID string, tokenID string, at time.Time) (bool, error) {
+	result, err := conn.Exec("update access_token set revoked_at = $3 where token_id = $1 and user_id = $2 and revoked_at is null", tokenID, userID, at.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	revoked, err := result.RowsAffected()
+	return revoked > 0, err
+}
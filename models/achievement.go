@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserAchievement is an achievement unlocked by a user
+type UserAchievement struct {
+	AchievementID string    `json:"achievement_id"`
+	UnlockedAt    time.Time `json:"unlocked_at"`
+}
+
+// UserStats are the figures achievements are evaluated against
+type UserStats struct {
+	// Completions is the number of periods completed
+	Completions int64 `json:"completions"`
+	// Quantities is the total quantity logged for each unit
+	Quantities    map[Unit]int64 `json:"quantities"`
+	LongestStreak int64          `json:"longest_streak"`
+	Experience    int64          `json:"experience"`
+	Purchases     int64          `json:"purchases"`
+}
+
+func FetchUserStats(conn *sql.Tx, userID string) (UserStats, error) {
+	stats := UserStats{Quantities: make(map[Unit]int64)}
+
+	rows, err := conn.Query("select t.unit, count(*) filter (where tc.completed), coalesce(sum(tc.quantity), 0) from task_completion tc inner join user_task ut on ut.user_task_id = tc.user_task_id inner join task t on t.task_id = ut.task_id where ut.user_id = $1 group by t.unit", userID)
+	if err != nil {
+		return UserStats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var unitStr string
+		var count, quantity int64
+		if err := rows.Scan(&unitStr, &count, &quantity); err != nil {
+			return UserStats{}, err
+		}
+
+		unit, err := UnitFromString(unitStr)
+		if err != nil {
+			return UserStats{}, err
+		}
+		stats.Completions += count
+		stats.Quantities[unit] += quantity
+	}
+	if err := rows.Err(); err != nil {
+		return UserStats{}, err
+	}
+
+	err = conn.QueryRow("select coalesce(max(longest_streak), 0) from user_task where user_id = $1", userID).Scan(&stats.LongestStreak)
+	if err != nil {
+		return UserStats{}, err
+	}
+
+	err = conn.QueryRow("select experience from user_experience where user_id = $1", userID).Scan(&stats.Experience)
+	if err != nil {
+		return UserStats{}, err
+	}
+
+	err = conn.QueryRow("select count(*) from experience_ledger where user_id = $1 and source = $2", userID, ExperienceSourcePurchase).Scan(&stats.Purchases)
+	if err != nil {
+		return UserStats{}, err
+	}
+
+	return stats, nil
+}
+
+// DailyActivity sums what a user did on a day
+type DailyActivity struct {
+	Date        string `json:"date"`
+	Completions int64  `json:"completions"`
+	Experience  int64  `json:"experience"`
+}
+
+// FetchDailyActivity returns the activity of a user for each day since from,
+// days being computed in the given timezone
+func FetchDailyActivity(conn *sql.Tx, userID string, loc *time.Location, from time.Time) ([]DailyActivity, error) {
+	activity := make([]DailyActivity, 0)
+
+	rows, err := conn.Query(`select to_char(day, 'YYYY-MM-DD'), sum(completions), sum(experience) from (
+			select (tc.complete_timestamp at time zone 'UTC' at time zone $2)::date as day, tc.completed::int as completions, 0 as experience
+			from task_completion tc inner join user_task ut on ut.user_task_id = tc.user_task_id
+			where ut.user_id = $1 and tc.complete_timestamp >= $3
+			union all
+			select (created_at at time zone 'UTC' at time zone $2)::date, 0, amount
+			from experience_ledger where user_id = $1 and created_at >= $3
+		) activity group by day order by day`, userID, loc.String(), from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day DailyActivity
+		if err := rows.Scan(&day.Date, &day.Completions, &day.Experience); err != nil {
+			return nil, err
+		}
+		activity = append(activity, day)
+	}
+
+	return activity, rows.Err()
+}
+
+func FetchUserAchievements(conn *sql.Tx, userID string) ([]UserAchievement, error) {
+	achievements := make([]UserAchievement, 0)
+
+	rows, err := conn.Query("select achievement_id, unlocked_at from user_achievement where user_id = $1 order by unlocked_at, achievement_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var achievement UserAchievement
+		if err := rows.Scan(&achievement.AchievementID, &achievement.UnlockedAt); err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, achievement)
+	}
+
+	return achievements, rows.Err()
+}
+
+// UnlockAchievement records an achievement for a user, returning false if it
+// was already unlocked
+func UnlockAchievement(conn *sql.Tx, userID string, achievementID string, at time.Time) (bool, error) {
+	result, err := conn.Exec("insert into user_achievement (user_id, achievement_id, unlocked_at) values ($1, $2, $3) on conflict (user_id, achievement_id) do nothing", userID, achievementID, at.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
@@ -2,46 +2,190 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// Category groups tasks. Categories without a user are global and shared by
+// everyone, the others are custom categories only visible to their user.
 type Category struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	UserID *string `json:"user_id"`
+}
+
+var (
+	ErrInvalidCategory = errors.New("invalid category")
+	ErrCategoryExists  = errors.New("category already exists")
+)
+
+// IsVisibleTo tells whether a user can see the category and assign it to tasks
+func (category Category) IsVisibleTo(userID string) bool {
+	return category.UserID == nil || *category.UserID == userID
 }
 
 func FetchOneCategory(conn *sql.Tx, categoryID string) (Category, error) {
 	var category Category
-	row := conn.QueryRow("select category_id, name from category where category_id = $1", categoryID)
-	err := row.Scan(&category.ID, &category.Name)
+	row := conn.QueryRow("select category_id, name, user_id from category where category_id = $1", categoryID)
+	err := row.Scan(&category.ID, &category.Name, &category.UserID)
 	return category, err
 }
 
-func FetchAllCategories(conn *sql.Tx, limit int, offset int) ([]Category, error) {
-	var categories []Category
-	rows, err := conn.Query("select category_id, name from category limit $1 offset $2", limit, offset)
+// FetchAllCategories returns the global categories and the custom ones of a user
+func FetchAllCategories(conn *sql.Tx, userID string, limit int, offset int) ([]Category, error) {
+	categories := make([]Category, 0)
+	rows, err := conn.Query("select category_id, name, user_id from category where user_id is null or user_id = $1 order by name limit $2 offset $3", userID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var category Category
-		err := rows.Scan(&category.ID, &category.Name)
+		err := rows.Scan(&category.ID, &category.Name, &category.UserID)
 		if err != nil {
 			return nil, err
 		}
 		categories = append(categories, category)
 	}
 
-	return categories, nil
+	return categories, rows.Err()
 }
 
-func CountCategories(conn *sql.Tx) (int, error) {
+func CountCategories(conn *sql.Tx, userID string) (int, error) {
 	var count int
-	err := conn.QueryRow("select count(*) from category").Scan(&count)
+	err := conn.QueryRow("select count(*) from category where user_id is null or user_id = $1", userID).Scan(&count)
 	return count, err
 }
 
 func CreateCategory(conn *sql.Tx, category Category) error {
-	_, err := conn.Exec("insert into category (category_id, name) values ($1, $2)", category.ID, category.Name)
+	if err := checkCategoryName(conn, category); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec("insert into category (category_id, name, user_id) values ($1, $2, $3)", category.ID, category.Name, category.UserID)
+	return err
+}
+
+func UpdateCategory(conn *sql.Tx, category Category) error {
+	if err := checkCategoryName(conn, category); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec("update category set name = $2 where category_id = $1", category.ID, category.Name)
 	return err
 }
+
+// checkCategoryName returns ErrCategoryExists when another category of the
+// same owner, or another global category, already has the name of the category
+func checkCategoryName(conn *sql.Tx, category Category) error {
+	var exists bool
+	err := conn.QueryRow("select exists (select 1 from category where lower(name) = lower($1) and user_id is not distinct from $2 and category_id <> $3)",
+		category.Name, category.UserID, category.ID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrCategoryExists
+	}
+	return nil
+}
+
+// DeleteCategory deletes a category, unassigning it from its tasks
+func DeleteCategory(conn *sql.Tx, categoryID string) error {
+	_, err := conn.Exec("delete from task_category where category_id = $1", categoryID)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec("delete from category where category_id = $1", categoryID)
+	return err
+}
+
+// ValidateCategoryIDs checks that the given category IDs are UUIDs, so that
+// they can be looked up
+func ValidateCategoryIDs(categoryIDs []string) error {
+	for _, categoryID := range categoryIDs {
+		if _, err := uuid.Parse(categoryID); err != nil {
+			return ErrInvalidCategory
+		}
+	}
+	return nil
+}
+
+// ValidateCategories checks that the given categories exist and are visible to a user
+func ValidateCategories(conn *sql.Tx, userID string, categoryIDs []string) error {
+	if err := ValidateCategoryIDs(categoryIDs); err != nil {
+		return err
+	}
+
+	for _, categoryID := range categoryIDs {
+		category, err := FetchOneCategory(conn, categoryID)
+		if err == sql.ErrNoRows || (err == nil && !category.IsVisibleTo(userID)) {
+			return ErrInvalidCategory
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTaskCategories replaces the categories a task is assigned to
+func SetTaskCategories(conn *sql.Tx, taskID string, categoryIDs []string) error {
+	_, err := conn.Exec("delete from task_category where task_id = $1", taskID)
+	if err != nil {
+		return err
+	}
+
+	for _, categoryID := range categoryIDs {
+		_, err = conn.Exec("insert into task_category (category_id, task_id) values ($1, $2) on conflict do nothing", categoryID, taskID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchTasksCategories fills the Categories of the given tasks
+func fetchTasksCategories(conn *sql.Tx, tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]string, len(tasks))
+	for i, task := range tasks {
+		taskIDs[i] = task.TaskID
+	}
+
+	rows, err := conn.Query("select task_category.task_id, category.category_id, category.name, category.user_id from task_category inner join category on category.category_id = task_category.category_id where task_category.task_id = any($1) order by category.name", pq.Array(taskIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	categories := make(map[string][]Category)
+	for rows.Next() {
+		var taskID string
+		var category Category
+		if err := rows.Scan(&taskID, &category.ID, &category.Name, &category.UserID); err != nil {
+			return err
+		}
+		categories[taskID] = append(categories[taskID], category)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range tasks {
+		tasks[i].Categories = categories[tasks[i].TaskID]
+		if tasks[i].Categories == nil {
+			tasks[i].Categories = make([]Category, 0)
+		}
+	}
+
+	return nil
+}
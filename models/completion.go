@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+type TaskCompletion struct {
+	CompletionID string    `json:"completion_id"`
+	TaskID       string    `json:"task_id"`
+	CompletedAt  time.Time `json:"completed_at"`
+	Note         *string   `json:"note"`
+	Quantity     int       `json:"quantity"`
+	// ExperienceGained includes the streak bonus awarded with the completion
+	ExperienceGained int `json:"experience_gained"`
+	// Completed is true when the completion reached the target of its period
+	Completed bool `json:"completed"`
+}
+
+type TaskCompletionFilter struct {
+	CompletionTimeMin *time.Time
+	CompletionTimeMax *time.Time
+}
+
+// FetchTaskCompletions returns the completion log of a task for a user, most recent first
+func FetchTaskCompletions(conn *sql.Tx, userID string, taskID string, filter TaskCompletionFilter, limit int, offset int) ([]TaskCompletion, int, error) {
+	completions := make([]TaskCompletion, 0)
+
+	from := " from task_completion inner join user_task on user_task.user_task_id = task_completion.user_task_id"
+	where := " where user_task.user_id = $1 and user_task.task_id = $2"
+	args := []interface{}{userID, taskID}
+
+	if filter.CompletionTimeMin != nil {
+		args = append(args, filter.CompletionTimeMin.UTC())
+		where += " and complete_timestamp >= $" + strconv.Itoa(len(args))
+	}
+
+	if filter.CompletionTimeMax != nil {
+		args = append(args, filter.CompletionTimeMax.UTC())
+		where += " and complete_timestamp < $" + strconv.Itoa(len(args))
+	}
+
+	query := "select completion_id, user_task.task_id, complete_timestamp, note, quantity, task_completion.experience_gained, completed" + from + where +
+		" order by complete_timestamp desc limit $" + strconv.Itoa(len(args)+1) + " offset $" + strconv.Itoa(len(args)+2)
+
+	rows, err := conn.Query(query, append(append([]interface{}{}, args...), limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var completion TaskCompletion
+		err := rows.Scan(&completion.CompletionID, &completion.TaskID, &completion.CompletedAt, &completion.Note, &completion.Quantity, &completion.ExperienceGained, &completion.Completed)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		completions = append(completions, completion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = conn.QueryRow("select count(*)"+from+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return completions, total, nil
+}
+
+func createTaskCompletion(conn *sql.Tx, userTaskID string, completion TaskCompletion) error {
+	_, err := conn.Exec("insert into task_completion (completion_id, user_task_id, complete_timestamp, note, quantity, experience_gained, completed) values ($1, $2, $3, $4, $5, $6, $7)",
+		completion.CompletionID, userTaskID, completion.CompletedAt.UTC(), completion.Note, completion.Quantity, completion.ExperienceGained, completion.Completed)
+	return err
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ExperienceSource string
+
+const (
+	ExperienceSourceTaskCompletion  ExperienceSource = "task_completion"
+	ExperienceSourcePurchase        ExperienceSource = "purchase"
+	ExperienceSourceBonus           ExperienceSource = "bonus"
+	ExperienceSourceAdminAdjustment ExperienceSource = "admin_adjustment"
+	ExperienceSourceRefund          ExperienceSource = "refund"
+	// ExperienceSourceOpeningBalance is the experience users had before the ledger existed
+	ExperienceSourceOpeningBalance ExperienceSource = "opening_balance"
+)
+
+// ExperienceEntry is an entry of the append-only experience ledger, the
+// experience of a user being the sum of its entries
+type ExperienceEntry struct {
+	EntryID string           `json:"entry_id"`
+	UserID  string           `json:"user_id"`
+	Amount  int64            `json:"amount"`
+	Source  ExperienceSource `json:"source"`
+	// ReferenceID identifies what the entry originates from (task completion, Stripe object...)
+	ReferenceID *string   `json:"reference_id"`
+	Note        *string   `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AddExperience appends an entry to the ledger and updates the experience of the user
+func AddExperience(conn *sql.Tx, entry ExperienceEntry) (ExperienceEntry, error) {
+	if entry.EntryID == "" {
+		entry.EntryID = uuid.New().String()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	_, err := conn.Exec("insert into experience_ledger (entry_id, user_id, amount, source, reference_id, note, created_at) values ($1, $2, $3, $4, $5, $6, $7)",
+		entry.EntryID, entry.UserID, entry.Amount, entry.Source, entry.ReferenceID, entry.Note, entry.CreatedAt.UTC())
+	if err != nil {
+		return ExperienceEntry{}, err
+	}
+
+	_, err = conn.Exec("update user_experience set experience = experience + $2 where user_id = $1", entry.UserID, entry.Amount)
+	if err != nil {
+		return ExperienceEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// FetchExperienceEntries returns the ledger of a user, most recent entries first
+func FetchExperienceEntries(conn *sql.Tx, userID string, limit int, offset int) ([]ExperienceEntry, int, error) {
+	entries := make([]ExperienceEntry, 0)
+
+	rows, err := conn.Query("select entry_id, user_id, amount, source, reference_id, note, created_at from experience_ledger where user_id = $1 order by created_at desc, entry_id limit $2 offset $3", userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry ExperienceEntry
+		err := rows.Scan(&entry.EntryID, &entry.UserID, &entry.Amount, &entry.Source, &entry.ReferenceID, &entry.Note, &entry.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = conn.QueryRow("select count(*) from experience_ledger where user_id = $1", userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
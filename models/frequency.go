@@ -0,0 +1,388 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FrequencyKind string
+
+const (
+	FrequencyOnce    FrequencyKind = "ONCE"
+	FrequencyDaily   FrequencyKind = "DAILY"
+	FrequencyWeekly  FrequencyKind = "WEEKLY"
+	FrequencyMonthly FrequencyKind = "MONTHLY"
+)
+
+// MonthDayLast can be used as Frequency.MonthDay to target the last day of the month
+const MonthDayLast = -1
+
+const maxFrequencyInterval = 366
+
+var (
+	ErrInvalidFrequency = errors.New("invalid frequency")
+)
+
+var weekdayStrings = map[time.Weekday]string{
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+	time.Sunday:    "SU",
+}
+
+var weekdayValues = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Frequency describes when a task is expected to be done. It is stored as an
+// RRULE-like string (e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;DTSTART=20250106").
+type Frequency struct {
+	Kind     FrequencyKind
+	Interval int
+	Weekdays []time.Weekday
+	MonthDay int
+	// Start is the date (at midnight UTC) the recurrence is anchored on, zero for none
+	Start time.Time
+}
+
+// Period is a span of time in which a recurring task is expected to be done
+// once. A zero End means the period never ends.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && (p.End.IsZero() || t.Before(p.End))
+}
+
+func ParseFrequency(s string) (Frequency, error) {
+	s = strings.TrimSpace(s)
+
+	switch strings.ToLower(s) {
+	case "", "once":
+		return Frequency{Kind: FrequencyOnce, Interval: 1}, nil
+	case "daily":
+		return Frequency{Kind: FrequencyDaily, Interval: 1}, nil
+	case "weekly":
+		return Frequency{Kind: FrequencyWeekly, Interval: 1}, nil
+	case "monthly":
+		return Frequency{Kind: FrequencyMonthly, Interval: 1}, nil
+	}
+
+	frequency := Frequency{Interval: 1}
+	rule := strings.TrimPrefix(strings.ToUpper(s), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Frequency{}, ErrInvalidFrequency
+		}
+
+		switch key {
+		case "FREQ":
+			switch kind := FrequencyKind(value); kind {
+			case FrequencyOnce, FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+				frequency.Kind = kind
+			default:
+				return Frequency{}, ErrInvalidFrequency
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > maxFrequencyInterval {
+				return Frequency{}, ErrInvalidFrequency
+			}
+			frequency.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdayValues[day]
+				if !ok {
+					return Frequency{}, ErrInvalidFrequency
+				}
+				frequency.Weekdays = append(frequency.Weekdays, weekday)
+			}
+		case "BYMONTHDAY":
+			monthDay, err := strconv.Atoi(value)
+			if err != nil || monthDay == 0 || monthDay < MonthDayLast || monthDay > 31 {
+				return Frequency{}, ErrInvalidFrequency
+			}
+			frequency.MonthDay = monthDay
+		case "DTSTART":
+			start, err := time.Parse("20060102", value)
+			if err != nil {
+				return Frequency{}, ErrInvalidFrequency
+			}
+			frequency.Start = start
+		default:
+			return Frequency{}, ErrInvalidFrequency
+		}
+	}
+
+	if frequency.Kind == "" {
+		return Frequency{}, ErrInvalidFrequency
+	}
+	if len(frequency.Weekdays) > 0 && frequency.Kind != FrequencyWeekly {
+		return Frequency{}, ErrInvalidFrequency
+	}
+	if frequency.MonthDay != 0 && frequency.Kind != FrequencyMonthly {
+		return Frequency{}, ErrInvalidFrequency
+	}
+
+	sort.Slice(frequency.Weekdays, func(i, j int) bool {
+		return weekdayIndex(frequency.Weekdays[i]) < weekdayIndex(frequency.Weekdays[j])
+	})
+
+	return frequency, nil
+}
+
+// String returns the canonical representation of the frequency, as stored in the database
+func (f Frequency) String() string {
+	if f.Kind == FrequencyOnce && f.Start.IsZero() {
+		return "once"
+	}
+
+	rule := "FREQ=" + string(f.Kind)
+	if f.Interval > 1 {
+		rule += ";INTERVAL=" + strconv.Itoa(f.Interval)
+	}
+	if len(f.Weekdays) > 0 {
+		days := make([]string, len(f.Weekdays))
+		for i, weekday := range f.Weekdays {
+			days[i] = weekdayStrings[weekday]
+		}
+		rule += ";BYDAY=" + strings.Join(days, ",")
+	}
+	if f.MonthDay != 0 {
+		rule += ";BYMONTHDAY=" + strconv.Itoa(f.MonthDay)
+	}
+	if !f.Start.IsZero() {
+		rule += ";DTSTART=" + f.Start.Format("20060102")
+	}
+	return rule
+}
+
+func (f Frequency) IsRecurring() bool {
+	return f.Kind != FrequencyOnce
+}
+
+func (f Frequency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+func (f *Frequency) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	frequency, err := ParseFrequency(s)
+	if err != nil {
+		return err
+	}
+
+	*f = frequency
+	return nil
+}
+
+// PeriodAt returns the period containing t, computed in t's location. It
+// returns false when t is before the first occurrence of the task.
+func (f Frequency) PeriodAt(t time.Time) (Period, bool) {
+	loc := t.Location()
+	anchor := f.anchor(loc)
+	day := dateOf(t)
+
+	if day.Before(anchor) {
+		return Period{}, false
+	}
+
+	if !f.IsRecurring() {
+		return Period{Start: anchor}, true
+	}
+
+	for i := 0; i <= f.maxGap(); i++ {
+		candidate := addDays(day, -i)
+		if candidate.Before(anchor) {
+			break
+		}
+		if f.occursOn(candidate, anchor) {
+			return Period{Start: candidate, End: f.next(candidate, anchor)}, true
+		}
+	}
+
+	return Period{}, false
+}
+
+// Periods returns the consecutive periods going from the one containing from
+// up to the one containing to, both included.
+func (f Frequency) Periods(from time.Time, to time.Time) []Period {
+	periods := make([]Period, 0)
+
+	period, ok := f.PeriodAt(from)
+	if !ok {
+		// from is before the first occurrence, start at the first one instead
+		anchor := f.anchor(from.Location())
+		for i := 0; i <= f.maxGap() && !ok; i++ {
+			period, ok = f.PeriodAt(addDays(anchor, i))
+		}
+		if !ok {
+			return periods
+		}
+	}
+
+	for !period.Start.After(to) {
+		periods = append(periods, period)
+		if period.End.IsZero() {
+			break
+		}
+		period, ok = f.PeriodAt(period.End)
+		if !ok {
+			break
+		}
+	}
+
+	return periods
+}
+
+func (f Frequency) next(day time.Time, anchor time.Time) time.Time {
+	for i := 1; i <= f.maxGap(); i++ {
+		candidate := addDays(day, i)
+		if f.occursOn(candidate, anchor) {
+			return candidate
+		}
+	}
+	return time.Time{}
+}
+
+func (f Frequency) occursOn(day time.Time, anchor time.Time) bool {
+	interval := max(f.Interval, 1)
+
+	switch f.Kind {
+	case FrequencyDaily:
+		return daysBetween(anchor, day)%interval == 0
+	case FrequencyWeekly:
+		// Like RRULE, weekly rules without days occur on the weekday of
+		// their start, tasks stored without a start on mondays
+		weekdays := f.Weekdays
+		if len(weekdays) == 0 && f.Start.IsZero() {
+			weekdays = []time.Weekday{time.Monday}
+		} else if len(weekdays) == 0 {
+			weekdays = []time.Weekday{anchor.Weekday()}
+		}
+
+		for _, weekday := range weekdays {
+			if day.Weekday() == weekday {
+				weeks := daysBetween(startOfWeek(anchor), startOfWeek(day)) / 7
+				return weeks%interval == 0
+			}
+		}
+		return false
+	case FrequencyMonthly:
+		daysInMonth := dateOf(time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location())).Day()
+		// Monthly rules without a day occur on the day of their start
+		target := f.MonthDay
+		if target == 0 && f.Start.IsZero() {
+			target = 1
+		} else if target == 0 {
+			target = anchor.Day()
+		}
+		if target == MonthDayLast || target > daysInMonth {
+			target = daysInMonth
+		}
+		if day.Day() != target {
+			return false
+		}
+
+		months := (day.Year()-anchor.Year())*12 + int(day.Month()-anchor.Month())
+		return months%interval == 0
+	}
+
+	return false
+}
+
+// maxGap is an upper bound on the number of days between two occurrences
+func (f Frequency) maxGap() int {
+	interval := max(f.Interval, 1)
+
+	switch f.Kind {
+	case FrequencyWeekly:
+		return 7 * (interval + 1)
+	case FrequencyMonthly:
+		return 31 * (interval + 1)
+	}
+	return interval
+}
+
+func (f Frequency) anchor(loc *time.Location) time.Time {
+	if f.Start.IsZero() {
+		return time.Date(1970, time.January, 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(f.Start.Year(), f.Start.Month(), f.Start.Day(), 0, 0, 0, 0, loc)
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func addDays(day time.Time, days int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day()+days, 0, 0, 0, 0, day.Location())
+}
+
+func daysBetween(from time.Time, to time.Time) int {
+	fromUTC := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toUTC := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toUTC.Sub(fromUTC).Hours() / 24)
+}
+
+func startOfWeek(day time.Time) time.Time {
+	return addDays(day, -weekdayIndex(day.Weekday()))
+}
+
+// weekdayIndex returns the position of the weekday in a week starting on monday
+func weekdayIndex(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+type TaskStatus string
+
+const (
+	TaskStatusUpcoming TaskStatus = "upcoming"
+	TaskStatusDue      TaskStatus = "due"
+	TaskStatusDone     TaskStatus = "done"
+	TaskStatusMissed   TaskStatus = "missed"
+)
+
+type PeriodState struct {
+	Period
+	Status TaskStatus
+}
+
+// PeriodStates returns the state of every period from the one containing from
+// up to the one containing now, a period being done once the quantities
+// completed during it reach the target.
+func (f Frequency) PeriodStates(completions []TaskCompletion, target int, from time.Time, now time.Time) []PeriodState {
+	periods := f.Periods(from, now)
+	states := make([]PeriodState, len(periods))
+
+	for i, period := range periods {
+		states[i] = PeriodState{Period: period, Status: TaskStatusDue}
+		if periodProgress(period, completions) >= completionTarget(target) {
+			states[i].Status = TaskStatusDone
+		} else if !period.End.IsZero() && !period.End.After(now) {
+			states[i].Status = TaskStatusMissed
+		}
+	}
+
+	return states
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseFrequency(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Frequency
+		err   bool
+	}{
+		{input: "", want: Frequency{Kind: FrequencyOnce, Interval: 1}},
+		{input: "once", want: Frequency{Kind: FrequencyOnce, Interval: 1}},
+		{input: "Daily", want: Frequency{Kind: FrequencyDaily, Interval: 1}},
+		{input: "weekly", want: Frequency{Kind: FrequencyWeekly, Interval: 1}},
+		{input: "monthly", want: Frequency{Kind: FrequencyMonthly, Interval: 1}},
+		{input: "FREQ=DAILY;INTERVAL=3", want: Frequency{Kind: FrequencyDaily, Interval: 3}},
+		{
+			input: "RRULE:FREQ=WEEKLY;BYDAY=FR,MO,WE",
+			want:  Frequency{Kind: FrequencyWeekly, Interval: 1, Weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}},
+		},
+		{input: "FREQ=MONTHLY;BYMONTHDAY=-1", want: Frequency{Kind: FrequencyMonthly, Interval: 1, MonthDay: MonthDayLast}},
+		{input: "FREQ=WEEKLY;DTSTART=20250108", want: Frequency{Kind: FrequencyWeekly, Interval: 1, Start: date(2025, time.January, 8)}},
+		{input: "every day", err: true},
+		{input: "FREQ=YEARLY", err: true},
+		{input: "INTERVAL=2", err: true},
+		{input: "FREQ=DAILY;INTERVAL=0", err: true},
+		{input: "FREQ=DAILY;INTERVAL=367", err: true},
+		{input: "FREQ=DAILY;BYDAY=MO", err: true},
+		{input: "FREQ=WEEKLY;BYDAY=XX", err: true},
+		{input: "FREQ=WEEKLY;BYMONTHDAY=1", err: true},
+		{input: "FREQ=MONTHLY;BYMONTHDAY=0", err: true},
+		{input: "FREQ=MONTHLY;BYMONTHDAY=32", err: true},
+		{input: "FREQ=DAILY;DTSTART=2025-01-08", err: true},
+		{input: "FREQ=DAILY;COUNT=3", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseFrequency(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseFrequency(%q) = %+v, want an error", test.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFrequency(%q) returned %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseFrequency(%q) = %+v, want %+v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFrequencyStringRoundTrip(t *testing.T) {
+	for _, input := range []string{"once", "FREQ=DAILY", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;DTSTART=20250106", "FREQ=MONTHLY;BYMONTHDAY=-1"} {
+		frequency, err := ParseFrequency(input)
+		if err != nil {
+			t.Fatalf("ParseFrequency(%q) returned %v", input, err)
+		}
+		if got := frequency.String(); got != input {
+			t.Errorf("ParseFrequency(%q).String() = %q", input, got)
+		}
+	}
+}
+
+func TestFrequencyOccursOn(t *testing.T) {
+	// 2025-01-08 is a wednesday
+	wednesday := date(2025, time.January, 8)
+
+	tests := []struct {
+		name      string
+		frequency Frequency
+		day       time.Time
+		want      bool
+	}{
+		{"daily", Frequency{Kind: FrequencyDaily, Interval: 1, Start: wednesday}, date(2025, time.January, 9), true},
+		{"every 3 days on", Frequency{Kind: FrequencyDaily, Interval: 3, Start: wednesday}, date(2025, time.January, 11), true},
+		{"every 3 days off", Frequency{Kind: FrequencyDaily, Interval: 3, Start: wednesday}, date(2025, time.January, 10), false},
+		{"weekly defaults to the start weekday", Frequency{Kind: FrequencyWeekly, Interval: 1, Start: wednesday}, date(2025, time.January, 15), true},
+		{"weekly not on monday when started on wednesday", Frequency{Kind: FrequencyWeekly, Interval: 1, Start: wednesday}, date(2025, time.January, 13), false},
+		{"weekly without start defaults to monday", Frequency{Kind: FrequencyWeekly, Interval: 1}, date(2025, time.January, 13), true},
+		{"weekly by day", Frequency{Kind: FrequencyWeekly, Interval: 1, Weekdays: []time.Weekday{time.Friday}, Start: wednesday}, date(2025, time.January, 10), true},
+		{"every 2 weeks off week", Frequency{Kind: FrequencyWeekly, Interval: 2, Start: wednesday}, date(2025, time.January, 15), false},
+		{"every 2 weeks on week", Frequency{Kind: FrequencyWeekly, Interval: 2, Start: wednesday}, date(2025, time.January, 22), true},
+		{"monthly defaults to the start day", Frequency{Kind: FrequencyMonthly, Interval: 1, Start: date(2025, time.January, 15)}, date(2025, time.February, 15), true},
+		{"monthly not on the 1st when started on the 15th", Frequency{Kind: FrequencyMonthly, Interval: 1, Start: date(2025, time.January, 15)}, date(2025, time.February, 1), false},
+		{"monthly without start defaults to the 1st", Frequency{Kind: FrequencyMonthly, Interval: 1}, date(2025, time.February, 1), true},
+		{"monthly start day clamped to short months", Frequency{Kind: FrequencyMonthly, Interval: 1, Start: date(2025, time.January, 31)}, date(2025, time.February, 28), true},
+		{"monthly last day", Frequency{Kind: FrequencyMonthly, Interval: 1, MonthDay: MonthDayLast}, date(2024, time.February, 29), true},
+		{"every 2 months off month", Frequency{Kind: FrequencyMonthly, Interval: 2, MonthDay: 10, Start: date(2025, time.January, 10)}, date(2025, time.February, 10), false},
+	}
+
+	for _, test := range tests {
+		anchor := test.frequency.anchor(time.UTC)
+		if got := test.frequency.occursOn(test.day, anchor); got != test.want {
+			t.Errorf("%s: occursOn(%s) = %v, want %v", test.name, test.day.Format("2006-01-02"), got, test.want)
+		}
+	}
+}
+
+func TestFrequencyPeriods(t *testing.T) {
+	wednesday := date(2025, time.January, 8)
+
+	tests := []struct {
+		name      string
+		frequency Frequency
+		from      time.Time
+		to        time.Time
+		want      []Period
+	}{
+		{
+			name:      "once",
+			frequency: Frequency{Kind: FrequencyOnce, Interval: 1, Start: wednesday},
+			from:      wednesday,
+			to:        date(2025, time.February, 1),
+			want:      []Period{{Start: wednesday}},
+		},
+		{
+			name:      "daily",
+			frequency: Frequency{Kind: FrequencyDaily, Interval: 1, Start: wednesday},
+			from:      wednesday,
+			to:        date(2025, time.January, 10),
+			want: []Period{
+				{Start: date(2025, time.January, 8), End: date(2025, time.January, 9)},
+				{Start: date(2025, time.January, 9), End: date(2025, time.January, 10)},
+				{Start: date(2025, time.January, 10), End: date(2025, time.January, 11)},
+			},
+		},
+		{
+			name:      "weekly created on a wednesday is due right away",
+			frequency: Frequency{Kind: FrequencyWeekly, Interval: 1, Start: wednesday},
+			from:      wednesday,
+			to:        date(2025, time.January, 16),
+			want: []Period{
+				{Start: date(2025, time.January, 8), End: date(2025, time.January, 15)},
+				{Start: date(2025, time.January, 15), End: date(2025, time.January, 22)},
+			},
+		},
+		{
+			name:      "weekly by days",
+			frequency: Frequency{Kind: FrequencyWeekly, Interval: 1, Weekdays: []time.Weekday{time.Monday, time.Friday}, Start: wednesday},
+			from:      wednesday,
+			to:        date(2025, time.January, 14),
+			want: []Period{
+				{Start: date(2025, time.January, 10), End: date(2025, time.January, 13)},
+				{Start: date(2025, time.January, 13), End: date(2025, time.January, 17)},
+			},
+		},
+		{
+			name:      "monthly created on the 15th is due right away",
+			frequency: Frequency{Kind: FrequencyMonthly, Interval: 1, Start: date(2025, time.January, 15)},
+			from:      date(2025, time.January, 15),
+			to:        date(2025, time.February, 20),
+			want: []Period{
+				{Start: date(2025, time.January, 15), End: date(2025, time.February, 15)},
+				{Start: date(2025, time.February, 15), End: date(2025, time.March, 15)},
+			},
+		},
+		{
+			name:      "before the start",
+			frequency: Frequency{Kind: FrequencyDaily, Interval: 2, Start: wednesday},
+			from:      date(2025, time.January, 1),
+			to:        date(2025, time.January, 9),
+			want: []Period{
+				{Start: date(2025, time.January, 8), End: date(2025, time.January, 10)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := test.frequency.Periods(test.from, test.to)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Periods() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
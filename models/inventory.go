@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// InventoryStreakFreeze is the inventory entry of streak freezes, which keep
+// a streak going when a single period is missed
+const InventoryStreakFreeze = "streak_freeze"
+
+type InventoryItem struct {
+	ItemID   string `json:"item_id"`
+	Quantity int64  `json:"quantity"`
+}
+
+func FetchInventory(conn *sql.Tx, userID string) ([]InventoryItem, error) {
+	inventory := make([]InventoryItem, 0)
+
+	rows, err := conn.Query("select item_id, quantity from user_inventory where user_id = $1 and quantity > 0 order by item_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item InventoryItem
+		if err := rows.Scan(&item.ItemID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		inventory = append(inventory, item)
+	}
+
+	return inventory, rows.Err()
+}
+
+func AddInventoryItem(conn *sql.Tx, userID string, itemID string, quantity int64) error {
+	_, err := conn.Exec("insert into user_inventory (user_id, item_id, quantity) values ($1, $2, $3) on conflict (user_id, item_id) do update set quantity = user_inventory.quantity + excluded.quantity", userID, itemID, quantity)
+	return err
+}
+
+// ConsumeInventoryItem uses one item of the inventory, returning false if the
+// user has none left
+func ConsumeInventoryItem(conn *sql.Tx, userID string, itemID string) (bool, error) {
+	result, err := conn.Exec("update user_inventory set quantity = quantity - 1 where user_id = $1 and item_id = $2 and quantity > 0", userID, itemID)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// RemoveInventoryItem takes items back from the inventory, never going below
+// zero since some of them may have been used already
+func RemoveInventoryItem(conn *sql.Tx, userID string, itemID string, quantity int64) error {
+	_, err := conn.Exec("update user_inventory set quantity = greatest(quantity - $3, 0) where user_id = $1 and item_id = $2", userID, itemID, quantity)
+	return err
+}
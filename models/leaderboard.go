@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+type LeaderboardPeriod string
+
+const (
+	LeaderboardGlobal  LeaderboardPeriod = "global"
+	LeaderboardWeekly  LeaderboardPeriod = "weekly"
+	LeaderboardMonthly LeaderboardPeriod = "monthly"
+)
+
+var (
+	ErrInvalidLeaderboardPeriod = errors.New("invalid leaderboard period")
+)
+
+func LeaderboardPeriodFromString(s string) (LeaderboardPeriod, error) {
+	switch period := LeaderboardPeriod(s); period {
+	case LeaderboardGlobal, LeaderboardWeekly, LeaderboardMonthly:
+		return period, nil
+	}
+	return LeaderboardGlobal, ErrInvalidLeaderboardPeriod
+}
+
+// Start returns the start of the current period of the leaderboard in UTC,
+// the global leaderboard having no start
+func (period LeaderboardPeriod) Start(now time.Time) time.Time {
+	now = now.UTC()
+	switch period {
+	case LeaderboardWeekly:
+		return startOfWeek(dateOf(now))
+	case LeaderboardMonthly:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// LeaderboardEntry is the position of a user on a leaderboard. The score is the
+// total experience of the user on the global leaderboard, and the experience
+// earned during the period on the others.
+type LeaderboardEntry struct {
+	Position int     `json:"position"`
+	UserID   string  `json:"user_id"`
+	Score    float64 `json:"score"`
+}
+
+// leaderboardQuery returns the query ranking the users who did not opt out of
+// the leaderboards, along with its arguments
+func leaderboardQuery(period LeaderboardPeriod, since time.Time) (string, []interface{}) {
+	if period == LeaderboardGlobal {
+		return "select user_id, score, row_number() over (order by score desc, user_id) as position from (" +
+			"select u.user_id, ue.experience::float8 as score from \"user\" u inner join user_experience ue on ue.user_id = u.user_id where not u.leaderboard_opt_out" +
+			") scores", []interface{}{}
+	}
+
+	return "select user_id, score, row_number() over (order by score desc, user_id) as position from (" +
+		"select u.user_id, sum(experience_ledger.amount)::float8 as score from \"user\" u" +
+		" inner join experience_ledger on experience_ledger.user_id = u.user_id" +
+		" where not u.leaderboard_opt_out and experience_ledger.created_at >= $1" +
+		" group by u.user_id having sum(experience_ledger.amount) > 0" +
+		") scores", []interface{}{since.UTC()}
+}
+
+func scanLeaderboardEntries(rows *sql.Rows) ([]LeaderboardEntry, error) {
+	defer rows.Close()
+
+	entries := make([]LeaderboardEntry, 0)
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.UserID, &entry.Score, &entry.Position); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// FetchLeaderboard returns a page of the leaderboard, along with the number of users ranked on it
+func FetchLeaderboard(conn *sql.Tx, period LeaderboardPeriod, since time.Time, limit int, offset int) ([]LeaderboardEntry, int, error) {
+	query, args := leaderboardQuery(period, since)
+
+	var total int
+	err := conn.QueryRow("select count(*) from ("+query+") board", args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := conn.Query(query+" order by position limit $"+strconv.Itoa(len(args)+1)+" offset $"+strconv.Itoa(len(args)+2), append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := scanLeaderboardEntries(rows)
+	return entries, total, err
+}
+
+// FetchAllLeaderboardEntries returns the whole leaderboard
+func FetchAllLeaderboardEntries(conn *sql.Tx, period LeaderboardPeriod, since time.Time) ([]LeaderboardEntry, error) {
+	query, args := leaderboardQuery(period, since)
+
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanLeaderboardEntries(rows)
+}
+
+// FetchLeaderboardEntry returns the position of a user on the leaderboard, or
+// nil if the user is not ranked on it
+func FetchLeaderboardEntry(conn *sql.Tx, period LeaderboardPeriod, since time.Time, userID string) (*LeaderboardEntry, error) {
+	query, args := leaderboardQuery(period, since)
+
+	var entry LeaderboardEntry
+	row := conn.QueryRow("select user_id, score, position from ("+query+") board where user_id = $"+strconv.Itoa(len(args)+1), append(args, userID)...)
+	err := row.Scan(&entry.UserID, &entry.Score, &entry.Position)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
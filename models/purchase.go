@@ -0,0 +1,286 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type PurchaseStatus string
+
+const (
+	// PurchaseStatusPending is the status of purchases whose payment is not
+	// confirmed yet, e.g. bank debits
+	PurchaseStatusPending PurchaseStatus = "pending"
+	PurchaseStatusPaid    PurchaseStatus = "paid"
+	PurchaseStatusFailed  PurchaseStatus = "failed"
+	// PurchaseStatusRefunded is the status of fully refunded purchases, partial
+	// refunds keeping the purchase paid
+	PurchaseStatusRefunded PurchaseStatus = "refunded"
+	PurchaseStatusDisputed PurchaseStatus = "disputed"
+	// PurchaseStatusChargedBack is the status of purchases whose dispute was lost
+	PurchaseStatusChargedBack PurchaseStatus = "charged_back"
+)
+
+// PurchaseItem is a line of a purchase
+type PurchaseItem struct {
+	ItemID   string `json:"item_id"`
+	Quantity int64  `json:"quantity"`
+	// Amount is the experience or the number of inventory items granted
+	Amount int64 `json:"amount"`
+	// InventoryItemID is the inventory entry granted, nil for experience
+	InventoryItemID *string `json:"inventory_item_id"`
+}
+
+// Purchase is a Stripe checkout session completed by a user
+type Purchase struct {
+	PurchaseID      string  `json:"purchase_id"`
+	UserID          string  `json:"user_id"`
+	SessionID       string  `json:"session_id"`
+	PaymentIntentID *string `json:"payment_intent_id"`
+	Amount          int64   `json:"amount"`
+	AmountRefunded  int64   `json:"amount_refunded"`
+	Currency        string  `json:"currency"`
+	// Product lists the identifiers of the items bought
+	Product string         `json:"product"`
+	Items   []PurchaseItem `json:"items"`
+	// Experience is the experience granted by the purchase once paid
+	Experience int64 `json:"experience"`
+	// InventoryGranted tells whether the inventory items of the purchase are
+	// currently held by the user
+	InventoryGranted bool           `json:"inventory_granted"`
+	Status           PurchaseStatus `json:"status"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+const selectPurchase = "select purchase_id, user_id, session_id, payment_intent_id, amount, amount_refunded, currency, product, experience, inventory_granted, status, created_at, updated_at from purchase"
+
+func scanPurchase(row scanner) (Purchase, error) {
+	var purchase Purchase
+	err := row.Scan(&purchase.PurchaseID, &purchase.UserID, &purchase.SessionID, &purchase.PaymentIntentID, &purchase.Amount, &purchase.AmountRefunded, &purchase.Currency, &purchase.Product, &purchase.Experience, &purchase.InventoryGranted, &purchase.Status, &purchase.CreatedAt, &purchase.UpdatedAt)
+	return purchase, err
+}
+
+func fetchOnePurchase(conn *sql.Tx, column string, value string) (Purchase, error) {
+	purchase, err := scanPurchase(conn.QueryRow(selectPurchase+" where "+column+" = $1 for update", value))
+	if err != nil {
+		return Purchase{}, err
+	}
+
+	purchases := []Purchase{purchase}
+	err = fetchPurchasesItems(conn, purchases)
+	return purchases[0], err
+}
+
+// FetchPurchaseBySessionID returns the purchase of a checkout session, locking
+// it until the end of the transaction
+func FetchPurchaseBySessionID(conn *sql.Tx, sessionID string) (Purchase, error) {
+	return fetchOnePurchase(conn, "session_id", sessionID)
+}
+
+// FetchPurchaseByPaymentIntentID returns the purchase paid by a payment
+// intent, locking it until the end of the transaction
+func FetchPurchaseByPaymentIntentID(conn *sql.Tx, paymentIntentID string) (Purchase, error) {
+	return fetchOnePurchase(conn, "payment_intent_id", paymentIntentID)
+}
+
+func FetchPurchases(conn *sql.Tx, userID string, limit int, offset int) ([]Purchase, int, error) {
+	purchases := make([]Purchase, 0)
+
+	rows, err := conn.Query(selectPurchase+" where user_id = $1 order by created_at desc, purchase_id limit $2 offset $3", userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		purchase, err := scanPurchase(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		purchases = append(purchases, purchase)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	if err := fetchPurchasesItems(conn, purchases); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = conn.QueryRow("select count(*) from purchase where user_id = $1", userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return purchases, total, nil
+}
+
+func CreatePurchase(conn *sql.Tx, purchase Purchase) (Purchase, error) {
+	if purchase.PurchaseID == "" {
+		purchase.PurchaseID = uuid.New().String()
+	}
+	if purchase.CreatedAt.IsZero() {
+		purchase.CreatedAt = time.Now()
+	}
+	purchase.UpdatedAt = purchase.CreatedAt
+
+	_, err := conn.Exec("insert into purchase (purchase_id, user_id, session_id, payment_intent_id, amount, currency, product, experience, status, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)",
+		purchase.PurchaseID, purchase.UserID, purchase.SessionID, purchase.PaymentIntentID, purchase.Amount, purchase.Currency, purchase.Product, purchase.Experience, purchase.Status, purchase.CreatedAt.UTC())
+	if err != nil {
+		return Purchase{}, err
+	}
+
+	for _, item := range purchase.Items {
+		_, err = conn.Exec("insert into purchase_item (purchase_id, item_id, quantity, amount, inventory_item_id) values ($1, $2, $3, $4, $5)",
+			purchase.PurchaseID, item.ItemID, item.Quantity, item.Amount, item.InventoryItemID)
+		if err != nil {
+			return Purchase{}, err
+		}
+	}
+
+	return purchase, nil
+}
+
+// fetchPurchasesItems sets the items of the purchases
+func fetchPurchasesItems(conn *sql.Tx, purchases []Purchase) error {
+	if len(purchases) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(purchases))
+	index := make(map[string]int)
+	for i := range purchases {
+		ids[i] = purchases[i].PurchaseID
+		index[purchases[i].PurchaseID] = i
+		purchases[i].Items = make([]PurchaseItem, 0)
+	}
+
+	rows, err := conn.Query("select purchase_id, item_id, quantity, amount, inventory_item_id from purchase_item where purchase_id = any($1) order by item_id", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var purchaseID string
+		var item PurchaseItem
+		if err := rows.Scan(&purchaseID, &item.ItemID, &item.Quantity, &item.Amount, &item.InventoryItemID); err != nil {
+			return err
+		}
+		i := index[purchaseID]
+		purchases[i].Items = append(purchases[i].Items, item)
+	}
+
+	return rows.Err()
+}
+
+func UpdatePurchaseStatus(conn *sql.Tx, purchaseID string, status PurchaseStatus, at time.Time) error {
+	_, err := conn.Exec("update purchase set status = $2, updated_at = $3 where purchase_id = $1", purchaseID, status, at.UTC())
+	return err
+}
+
+func UpdatePurchaseRefund(conn *sql.Tx, purchaseID string, amountRefunded int64, status PurchaseStatus, at time.Time) error {
+	_, err := conn.Exec("update purchase set amount_refunded = $2, status = $3, updated_at = $4 where purchase_id = $1", purchaseID, amountRefunded, status, at.UTC())
+	return err
+}
+
+// ExperienceDue returns the experience the user should hold from the purchase:
+// all of it once paid, minus the refunded share, and none while disputed
+func (purchase Purchase) ExperienceDue() int64 {
+	switch purchase.Status {
+	case PurchaseStatusPaid, PurchaseStatusRefunded:
+		if purchase.Amount <= 0 {
+			return purchase.Experience
+		}
+		kept := max(purchase.Amount-purchase.AmountRefunded, 0)
+		return purchase.Experience * kept / purchase.Amount
+	}
+	return 0
+}
+
+// clampReversal limits a negative delta so that the experience of a user,
+// total, does not go below the experience they earned from other sources than
+// purchases
+func clampReversal(delta int64, total int64, earned int64) int64 {
+	return max(delta, -max(total-earned, 0))
+}
+
+// SyncPurchaseExperience adds the ledger entries bringing the experience held
+// from a purchase to what is due. Reversals never take the user below the
+// experience earned from other sources than purchases, so they may be partial.
+func SyncPurchaseExperience(conn *sql.Tx, purchase Purchase, note *string, at time.Time) (int64, error) {
+	var held int64
+	err := conn.QueryRow("select coalesce(sum(amount), 0) from experience_ledger where user_id = $1 and reference_id = $2 and source in ($3, $4)",
+		purchase.UserID, purchase.SessionID, ExperienceSourcePurchase, ExperienceSourceRefund).Scan(&held)
+	if err != nil {
+		return 0, err
+	}
+
+	delta := purchase.ExperienceDue() - held
+	source := ExperienceSourcePurchase
+	if delta < 0 {
+		source = ExperienceSourceRefund
+
+		var total, earned int64
+		err := conn.QueryRow("select coalesce(sum(amount), 0), coalesce(sum(amount) filter (where source not in ($2, $3)), 0) from experience_ledger where user_id = $1",
+			purchase.UserID, ExperienceSourcePurchase, ExperienceSourceRefund).Scan(&total, &earned)
+		if err != nil {
+			return 0, err
+		}
+		delta = clampReversal(delta, total, earned)
+	}
+	if delta == 0 {
+		return 0, nil
+	}
+
+	_, err = AddExperience(conn, ExperienceEntry{
+		UserID:      purchase.UserID,
+		Amount:      delta,
+		Source:      source,
+		ReferenceID: &purchase.SessionID,
+		Note:        note,
+		CreatedAt:   at,
+	})
+	return delta, err
+}
+
+// InventoryDue tells whether the user should hold the inventory items of the
+// purchase: only while it is paid, full refunds and disputes taking them back
+func (purchase Purchase) InventoryDue() bool {
+	return purchase.Status == PurchaseStatusPaid
+}
+
+// SyncPurchaseInventory grants or takes back the inventory items of a purchase
+// so that the user holds them only when due. Items already used are not taken
+// back.
+func SyncPurchaseInventory(conn *sql.Tx, purchase Purchase, at time.Time) error {
+	due := purchase.InventoryDue()
+	if due == purchase.InventoryGranted {
+		return nil
+	}
+
+	for _, item := range purchase.Items {
+		if item.InventoryItemID == nil {
+			continue
+		}
+
+		var err error
+		if due {
+			err = AddInventoryItem(conn, purchase.UserID, *item.InventoryItemID, item.Amount)
+		} else {
+			err = RemoveInventoryItem(conn, purchase.UserID, *item.InventoryItemID, item.Amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.Exec("update purchase set inventory_granted = $2, updated_at = $3 where purchase_id = $1", purchase.PurchaseID, due, at.UTC())
+	return err
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestExperienceDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		purchase Purchase
+		want     int64
+	}{
+		{"pending", Purchase{Amount: 500, Experience: 1000, Status: PurchaseStatusPending}, 0},
+		{"failed", Purchase{Amount: 500, Experience: 1000, Status: PurchaseStatusFailed}, 0},
+		{"paid", Purchase{Amount: 500, Experience: 1000, Status: PurchaseStatusPaid}, 1000},
+		{"free", Purchase{Amount: 0, Experience: 1000, Status: PurchaseStatusPaid}, 1000},
+		{"partial refund", Purchase{Amount: 500, AmountRefunded: 150, Experience: 1000, Status: PurchaseStatusPaid}, 700},
+		{"rounded partial refund", Purchase{Amount: 300, AmountRefunded: 100, Experience: 1000, Status: PurchaseStatusPaid}, 666},
+		{"full refund", Purchase{Amount: 500, AmountRefunded: 500, Experience: 1000, Status: PurchaseStatusRefunded}, 0},
+		{"refund above the amount", Purchase{Amount: 500, AmountRefunded: 600, Experience: 1000, Status: PurchaseStatusRefunded}, 0},
+		{"disputed", Purchase{Amount: 500, Experience: 1000, Status: PurchaseStatusDisputed}, 0},
+		// A won dispute settles the purchase back to paid
+		{"dispute won", Purchase{Amount: 500, Experience: 1000, Status: PurchaseStatusPaid}, 1000},
+		{"dispute won after a partial refund", Purchase{Amount: 500, AmountRefunded: 250, Experience: 1000, Status: PurchaseStatusPaid}, 500},
+		{"dispute lost", Purchase{Amount: 500, Experience: 1000, Status: PurchaseStatusChargedBack}, 0},
+	}
+
+	for _, test := range tests {
+		if got := test.purchase.ExperienceDue(); got != test.want {
+			t.Errorf("%s: ExperienceDue() = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClampReversal(t *testing.T) {
+	tests := []struct {
+		name   string
+		delta  int64
+		total  int64
+		earned int64
+		want   int64
+	}{
+		{"purchased experience left", -1000, 3000, 500, -1000},
+		{"exactly the purchased experience", -1000, 1500, 500, -1000},
+		{"purchased experience partly reversed already", -1000, 1200, 500, -700},
+		{"nothing but earned experience", -1000, 500, 500, 0},
+		{"total below earned", -1000, 200, 500, 0},
+	}
+
+	for _, test := range tests {
+		got := clampReversal(test.delta, test.total, test.earned)
+		if got != test.want {
+			t.Errorf("%s: clampReversal(%d, %d, %d) = %d, want %d", test.name, test.delta, test.total, test.earned, got, test.want)
+		}
+		if test.total+got < min(test.earned, test.total) {
+			t.Errorf("%s: the user would drop to %d experience, below the %d earned", test.name, test.total+got, test.earned)
+		}
+	}
+}
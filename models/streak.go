@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TaskStreak counts the consecutive periods a recurring task was completed in
+type TaskStreak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// Experience awarded when a streak reaches the given length
+var streakMilestones = map[int]int{
+	7:   250,
+	30:  1000,
+	100: 5000,
+}
+
+// milestoneBonus returns the experience awarded when a streak reaches the
+// given length
+func milestoneBonus(current int) int {
+	return streakMilestones[current]
+}
+
+// extendStreak returns the streak after completing a task in the given period,
+// lastPeriodStart being the start of the last period the streak was extended in.
+func extendStreak(streak TaskStreak, lastPeriodStart *time.Time, frequency Frequency, period Period) TaskStreak {
+	if frequency.IsRecurring() && lastPeriodStart != nil && isPreviousPeriod(frequency, *lastPeriodStart, period) {
+		streak.Current++
+	} else {
+		streak.Current = 1
+	}
+
+	streak.Longest = max(streak.Longest, streak.Current)
+	return streak
+}
+
+// currentStreak returns the streak as seen at the given time: a streak whose
+// last period is neither the current nor the previous one has been broken.
+func currentStreak(streak TaskStreak, lastPeriodStart *time.Time, frequency Frequency, at time.Time) TaskStreak {
+	if lastPeriodStart == nil {
+		return TaskStreak{Longest: streak.Longest}
+	}
+
+	period, ok := frequency.PeriodAt(at)
+	if !ok {
+		return streak
+	}
+
+	if !period.Start.Equal(*lastPeriodStart) && !isPreviousPeriod(frequency, *lastPeriodStart, period) {
+		streak.Current = 0
+	}
+	return streak
+}
+
+func isPreviousPeriod(frequency Frequency, start time.Time, period Period) bool {
+	previous, ok := frequency.PeriodAt(period.Start.Add(-time.Nanosecond))
+	return ok && previous.Start.Equal(start)
+}
+
+// missedPeriod returns the period between the one starting at start and the
+// given one when it is the only period missed, which a streak freeze covers
+func missedPeriod(frequency Frequency, start time.Time, period Period) (Period, bool) {
+	previous, ok := frequency.PeriodAt(period.Start.Add(-time.Nanosecond))
+	if !ok || !isPreviousPeriod(frequency, start, previous) {
+		return Period{}, false
+	}
+	return previous, true
+}
+
+func fetchStreak(conn *sql.Tx, userTaskID string) (TaskStreak, *time.Time, error) {
+	var streak TaskStreak
+	var lastPeriodStart *time.Time
+	row := conn.QueryRow("select current_streak, longest_streak, streak_period_start from user_task where user_task_id = $1", userTaskID)
+	err := row.Scan(&streak.Current, &streak.Longest, &lastPeriodStart)
+	return streak, lastPeriodStart, err
+}
+
+// ResetStreaks resets the current streaks of a task whose recurrence changed,
+// the periods completed so far not matching the new ones. Longest streaks are
+// kept.
+func ResetStreaks(conn *sql.Tx, taskID string) error {
+	_, err := conn.Exec("update user_task set current_streak = 0, streak_period_start = null where task_id = $1", taskID)
+	return err
+}
+
+func updateStreak(conn *sql.Tx, userTaskID string, streak TaskStreak, periodStart time.Time) error {
+	_, err := conn.Exec("update user_task set current_streak = $2, longest_streak = $3, streak_period_start = $4 where user_task_id = $1", userTaskID, streak.Current, streak.Longest, periodStart.UTC())
+	return err
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtendStreak(t *testing.T) {
+	daily := Frequency{Kind: FrequencyDaily, Interval: 1, Start: date(2025, time.January, 1)}
+	// Every other week on wednesdays, starting on wednesday 2025-01-08
+	biweekly := Frequency{Kind: FrequencyWeekly, Interval: 2, Start: date(2025, time.January, 8)}
+
+	tests := []struct {
+		name            string
+		streak          TaskStreak
+		lastPeriodStart *time.Time
+		frequency       Frequency
+		day             time.Time
+		want            TaskStreak
+	}{
+		{"first completion", TaskStreak{}, nil, daily, date(2025, time.January, 5), TaskStreak{Current: 1, Longest: 1}},
+		{"consecutive period", TaskStreak{Current: 3, Longest: 3}, ptr(date(2025, time.January, 4)), daily, date(2025, time.January, 5), TaskStreak{Current: 4, Longest: 4}},
+		{"broken streak", TaskStreak{Current: 3, Longest: 5}, ptr(date(2025, time.January, 2)), daily, date(2025, time.January, 5), TaskStreak{Current: 1, Longest: 5}},
+		{"longest kept", TaskStreak{Current: 2, Longest: 10}, ptr(date(2025, time.January, 4)), daily, date(2025, time.January, 5), TaskStreak{Current: 3, Longest: 10}},
+		{"once", TaskStreak{Current: 1, Longest: 1}, ptr(date(2025, time.January, 1)), Frequency{Kind: FrequencyOnce, Interval: 1}, date(2025, time.January, 2), TaskStreak{Current: 1, Longest: 1}},
+		{"weekly interval consecutive", TaskStreak{Current: 1, Longest: 1}, ptr(date(2025, time.January, 8)), biweekly, date(2025, time.January, 23), TaskStreak{Current: 2, Longest: 2}},
+		{"weekly interval broken", TaskStreak{Current: 1, Longest: 1}, ptr(date(2025, time.January, 8)), biweekly, date(2025, time.February, 6), TaskStreak{Current: 1, Longest: 1}},
+	}
+
+	for _, test := range tests {
+		period, ok := test.frequency.PeriodAt(test.day)
+		if !ok {
+			t.Fatalf("%s: no period at %s", test.name, test.day)
+		}
+		if got := extendStreak(test.streak, test.lastPeriodStart, test.frequency, period); got != test.want {
+			t.Errorf("%s: extendStreak() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCurrentStreak(t *testing.T) {
+	daily := Frequency{Kind: FrequencyDaily, Interval: 1, Start: date(2025, time.January, 1)}
+	streak := TaskStreak{Current: 4, Longest: 6}
+
+	tests := []struct {
+		name            string
+		lastPeriodStart *time.Time
+		at              time.Time
+		want            TaskStreak
+	}{
+		{"never completed", nil, date(2025, time.January, 5), TaskStreak{Longest: 6}},
+		{"completed in the current period", ptr(date(2025, time.January, 5)), date(2025, time.January, 5).Add(12 * time.Hour), streak},
+		{"completed in the previous period", ptr(date(2025, time.January, 4)), date(2025, time.January, 5), streak},
+		{"broken", ptr(date(2025, time.January, 3)), date(2025, time.January, 5), TaskStreak{Current: 0, Longest: 6}},
+	}
+
+	for _, test := range tests {
+		if got := currentStreak(streak, test.lastPeriodStart, daily, test.at); got != test.want {
+			t.Errorf("%s: currentStreak() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMissedPeriod(t *testing.T) {
+	daily := Frequency{Kind: FrequencyDaily, Interval: 1, Start: date(2025, time.January, 1)}
+	biweekly := Frequency{Kind: FrequencyWeekly, Interval: 2, Start: date(2025, time.January, 8)}
+
+	tests := []struct {
+		name      string
+		frequency Frequency
+		start     time.Time
+		day       time.Time
+		want      Period
+		ok        bool
+	}{
+		{"one missed day is covered", daily, date(2025, time.January, 3), date(2025, time.January, 5), Period{Start: date(2025, time.January, 4), End: date(2025, time.January, 5)}, true},
+		{"consecutive days miss nothing", daily, date(2025, time.January, 4), date(2025, time.January, 5), Period{}, false},
+		{"two missed days are not covered", daily, date(2025, time.January, 2), date(2025, time.January, 5), Period{}, false},
+		{"one missed period of two weeks", biweekly, date(2025, time.January, 8), date(2025, time.February, 5), Period{Start: date(2025, time.January, 22), End: date(2025, time.February, 5)}, true},
+	}
+
+	for _, test := range tests {
+		period, ok := test.frequency.PeriodAt(test.day)
+		if !ok {
+			t.Fatalf("%s: no period at %s", test.name, test.day)
+		}
+		got, gotOk := missedPeriod(test.frequency, test.start, period)
+		if got != test.want || gotOk != test.ok {
+			t.Errorf("%s: missedPeriod() = %v, %v, want %v, %v", test.name, got, gotOk, test.want, test.ok)
+		}
+	}
+}
+
+func TestMilestoneBonus(t *testing.T) {
+	tests := []struct {
+		current int
+		want    int
+	}{
+		{1, 0},
+		{6, 0},
+		{7, 250},
+		{8, 0},
+		{30, 1000},
+		{100, 5000},
+		{101, 0},
+	}
+
+	for _, test := range tests {
+		if got := milestoneBonus(test.current); got != test.want {
+			t.Errorf("milestoneBonus(%d) = %d, want %d", test.current, got, test.want)
+		}
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
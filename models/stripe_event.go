@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type StripeEventStatus string
+
+const (
+	StripeEventProcessed StripeEventStatus = "processed"
+	// StripeEventIgnored is the status of the events the server does not handle
+	StripeEventIgnored StripeEventStatus = "ignored"
+	StripeEventFailed  StripeEventStatus = "failed"
+)
+
+var (
+	ErrInvalidStripeEventStatus = errors.New("invalid stripe event status")
+)
+
+func StripeEventStatusFromString(s string) (StripeEventStatus, error) {
+	switch status := StripeEventStatus(s); status {
+	case StripeEventProcessed, StripeEventIgnored, StripeEventFailed:
+		return status, nil
+	}
+	return "", ErrInvalidStripeEventStatus
+}
+
+// StripeEvent is a webhook event received from Stripe, recorded so that
+// retried deliveries are only processed once
+type StripeEvent struct {
+	EventID    string            `json:"event_id"`
+	Type       string            `json:"type"`
+	Status     StripeEventStatus `json:"status"`
+	Error      *string           `json:"error"`
+	Attempts   int               `json:"attempts"`
+	ReceivedAt time.Time         `json:"received_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// RecordStripeEvent marks an event as processed (or ignored). It must be called
+// within the transaction applying the event, and returns false when the event
+// was already processed, in which case the transaction must not apply it again.
+// Events which previously failed are processed again.
+func RecordStripeEvent(conn *sql.Tx, eventID string, eventType string, status StripeEventStatus, at time.Time) (bool, error) {
+	result, err := conn.Exec(`insert into stripe_event (event_id, type, status, attempts, received_at, updated_at) values ($1, $2, $3, 1, $4, $4)
+		on conflict (event_id) do update set status = excluded.status, error = null, attempts = stripe_event.attempts + 1, updated_at = excluded.updated_at
+		where stripe_event.status = $5`, eventID, eventType, status, at.UTC(), StripeEventFailed)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// RecordStripeEventFailure marks an event as failed, unless it was processed
+// in the meantime
+func RecordStripeEventFailure(conn *sql.Tx, eventID string, eventType string, cause error, at time.Time) error {
+	message := cause.Error()
+	_, err := conn.Exec(`insert into stripe_event (event_id, type, status, error, attempts, received_at, updated_at) values ($1, $2, $3, $4, 1, $5, $5)
+		on conflict (event_id) do update set status = excluded.status, error = excluded.error, attempts = stripe_event.attempts + 1, updated_at = excluded.updated_at
+		where stripe_event.status = excluded.status`, eventID, eventType, StripeEventFailed, message, at.UTC())
+	return err
+}
+
+// FetchStripeEvents returns the recorded events, most recent first, optionally
+// filtered by status
+func FetchStripeEvents(conn *sql.Tx, status *StripeEventStatus, limit int, offset int) ([]StripeEvent, int, error) {
+	events := make([]StripeEvent, 0)
+
+	rows, err := conn.Query("select event_id, type, status, error, attempts, received_at, updated_at from stripe_event where $1::text is null or status = $1 order by received_at desc, event_id limit $2 offset $3", status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event StripeEvent
+		err := rows.Scan(&event.EventID, &event.Type, &event.Status, &event.Error, &event.Attempts, &event.ReceivedAt, &event.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = conn.QueryRow("select count(*) from stripe_event where $1::text is null or status = $1", status).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SubscriptionStatus mirrors the status of Stripe subscriptions
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive   SubscriptionStatus = "active"
+	SubscriptionStatusTrialing SubscriptionStatus = "trialing"
+	SubscriptionStatusPastDue  SubscriptionStatus = "past_due"
+	SubscriptionStatusCanceled SubscriptionStatus = "canceled"
+)
+
+// Subscription is the Hobbit Premium subscription of a user
+type Subscription struct {
+	SubscriptionID    string             `json:"subscription_id"`
+	UserID            string             `json:"user_id"`
+	CustomerID        string             `json:"customer_id"`
+	Status            SubscriptionStatus `json:"status"`
+	CurrentPeriodEnd  *time.Time         `json:"current_period_end"`
+	CancelAtPeriodEnd bool               `json:"cancel_at_period_end"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+	// LastEventAt is the creation time of the last Stripe event applied to the
+	// subscription, older events being delivered late
+	LastEventAt time.Time `json:"-"`
+}
+
+// IsPremium reports whether a subscription status grants the premium
+// features. Past due subscriptions keep them while Stripe retries the payment.
+func (status SubscriptionStatus) IsPremium() bool {
+	switch status {
+	case SubscriptionStatusActive, SubscriptionStatusTrialing, SubscriptionStatusPastDue:
+		return true
+	}
+	return false
+}
+
+// FetchSubscription returns a subscription, locking it until the end of the
+// transaction so that its events are applied one at a time
+func FetchSubscription(conn *sql.Tx, subscriptionID string) (Subscription, error) {
+	var subscription Subscription
+	row := conn.QueryRow("select subscription_id, user_id, customer_id, status, current_period_end, cancel_at_period_end, created_at, updated_at, last_event_at from subscription where subscription_id = $1 for update", subscriptionID)
+	err := row.Scan(&subscription.SubscriptionID, &subscription.UserID, &subscription.CustomerID, &subscription.Status, &subscription.CurrentPeriodEnd, &subscription.CancelAtPeriodEnd, &subscription.CreatedAt, &subscription.UpdatedAt, &subscription.LastEventAt)
+	return subscription, err
+}
+
+// SaveSubscription creates or updates a subscription, unless it was updated by
+// a more recent event in the meantime
+func SaveSubscription(conn *sql.Tx, subscription Subscription) error {
+	var periodEnd *time.Time
+	if subscription.CurrentPeriodEnd != nil {
+		utc := subscription.CurrentPeriodEnd.UTC()
+		periodEnd = &utc
+	}
+
+	_, err := conn.Exec(`insert into subscription (subscription_id, user_id, customer_id, status, current_period_end, cancel_at_period_end, created_at, updated_at, last_event_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		on conflict (subscription_id) do update set status = excluded.status, current_period_end = excluded.current_period_end, cancel_at_period_end = excluded.cancel_at_period_end, updated_at = excluded.updated_at, last_event_at = excluded.last_event_at
+		where subscription.last_event_at <= excluded.last_event_at`,
+		subscription.SubscriptionID, subscription.UserID, subscription.CustomerID, subscription.Status, periodEnd, subscription.CancelAtPeriodEnd, subscription.CreatedAt.UTC(), subscription.UpdatedAt.UTC(), subscription.LastEventAt.UTC())
+	return err
+}
+
+// UpdateSubscriptionStatus sets the status of a subscription from an event
+// created at eventAt, unless a more recent event was applied already
+func UpdateSubscriptionStatus(conn *sql.Tx, subscriptionID string, status SubscriptionStatus, eventAt time.Time, at time.Time) error {
+	_, err := conn.Exec("update subscription set status = $2, last_event_at = $3, updated_at = $4 where subscription_id = $1 and last_event_at <= $3", subscriptionID, status, eventAt.UTC(), at.UTC())
+	return err
+}
@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"math"
 	"strconv"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Unit int
@@ -33,9 +35,19 @@ var unitValues = map[string]Unit{
 }
 
 var (
-	ErrInvalidUnit = errors.New("invalid unit")
+	ErrInvalidUnit     = errors.New("invalid unit")
+	ErrInvalidQuantity = errors.New("invalid quantity")
 )
 
+// Bounds of the quantities accepted for each unit. Distances are expressed in
+// meters and times in seconds.
+var unitQuantityLimits = map[Unit][2]int{
+	UnitNone:     {0, 100},
+	UnitDistance: {1, 1000000},
+	UnitReps:     {1, 100000},
+	UnitTime:     {1, 7 * 24 * 3600},
+}
+
 func UnitFromString(s string) (Unit, error) {
 	if u, ok := unitValues[s]; ok {
 		return u, nil
@@ -47,6 +59,24 @@ func (unit Unit) MarshalJSON() ([]byte, error) {
 	return []byte("\"" + unitStrings[unit] + "\""), nil
 }
 
+// MarshalText allows units to be used as JSON object keys
+func (unit Unit) MarshalText() ([]byte, error) {
+	return []byte(unitStrings[unit]), nil
+}
+
+// ValidateQuantity checks that a quantity makes sense for the unit
+func (unit Unit) ValidateQuantity(quantity int) error {
+	limits, ok := unitQuantityLimits[unit]
+	if !ok {
+		return ErrInvalidUnit
+	}
+
+	if quantity < limits[0] || quantity > limits[1] {
+		return ErrInvalidQuantity
+	}
+	return nil
+}
+
 type taskFromQuery struct {
 	TaskID           string
 	Quantity         int
@@ -57,20 +87,47 @@ type taskFromQuery struct {
 	ExperienceGained int
 	IsPublic         bool
 	UserID           *string
+	UserTaskID       *string
+	ArchivedAt       *time.Time
 }
 
 type Task struct {
-	TaskID           string  `json:"task_id"`
-	Quantity         int     `json:"quantity"`
-	Unit             Unit    `json:"unit"`
-	Name             string  `json:"name"`
-	Description      string  `json:"description"`
-	Frequency        string  `json:"frequency"`
-	ExperienceGained int     `json:"experience_gained"`
-	IsPublic         bool    `json:"is_public"`
-	UserID           *string `json:"user_id"`
+	TaskID           string    `json:"task_id"`
+	Quantity         int       `json:"quantity"`
+	Unit             Unit      `json:"unit"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	Frequency        Frequency `json:"frequency"`
+	ExperienceGained int       `json:"experience_gained"`
+	IsPublic         bool      `json:"is_public"`
+	// UserID is the owner of a private task, public tasks have none
+	UserID *string `json:"user_id"`
+	// Tracked tells whether the user the task was fetched for created or adopted it
+	Tracked    bool        `json:"tracked"`
+	ArchivedAt *time.Time  `json:"archived_at"`
+	Categories []Category  `json:"categories"`
+	State      *TaskState  `json:"state,omitempty"`
+	Streak     *TaskStreak `json:"streak,omitempty"`
+
+	userTaskID *string
+}
+
+// TaskState is the completion state of a task for the current period
+type TaskState struct {
+	Status      TaskStatus `json:"status"`
+	PeriodStart *time.Time `json:"period_start"`
+	PeriodEnd   *time.Time `json:"period_end"`
+	Progress    int        `json:"progress"`
 }
 
+var (
+	ErrTaskNotDue           = errors.New("task is not due yet")
+	ErrTaskAlreadyCompleted = errors.New("task already completed for the current period")
+	ErrTaskArchived         = errors.New("task is archived")
+	ErrTaskNotTracked       = errors.New("task is not tracked by the user")
+	ErrTaskAlreadyTracked   = errors.New("task is already tracked by the user")
+)
+
 func makeTask(task taskFromQuery) Task {
 	return Task{
 		TaskID:           task.TaskID,
@@ -78,10 +135,13 @@ func makeTask(task taskFromQuery) Task {
 		Unit:             unitValues[task.Unit],
 		Name:             task.Name,
 		Description:      task.Description,
-		Frequency:        task.Frequency,
+		Frequency:        parseStoredFrequency(task.Frequency),
 		ExperienceGained: task.ExperienceGained,
 		IsPublic:         task.IsPublic,
 		UserID:           task.UserID,
+		Tracked:          task.UserTaskID != nil,
+		ArchivedAt:       task.ArchivedAt,
+		userTaskID:       task.UserTaskID,
 	}
 }
 
@@ -92,21 +152,78 @@ func makeTaskFromQuery(task Task) taskFromQuery {
 		Unit:             unitStrings[task.Unit],
 		Name:             task.Name,
 		Description:      task.Description,
-		Frequency:        task.Frequency,
+		Frequency:        task.Frequency.String(),
 		ExperienceGained: task.ExperienceGained,
 		IsPublic:         task.IsPublic,
 		UserID:           task.UserID,
 	}
 }
 
+// parseStoredFrequency parses a frequency read from the database. Tasks created
+// before frequencies were validated may contain free-form text, which is
+// considered as a one-time task.
+func parseStoredFrequency(s string) Frequency {
+	frequency, err := ParseFrequency(s)
+	if err != nil {
+		return Frequency{Kind: FrequencyOnce, Interval: 1}
+	}
+	return frequency
+}
+
+func makeTaskState(frequency Frequency, target int, completions []TaskCompletion, at time.Time) TaskState {
+	period, ok := frequency.PeriodAt(at)
+	if !ok {
+		return TaskState{Status: TaskStatusUpcoming}
+	}
+
+	state := TaskState{Status: TaskStatusDue, PeriodStart: &period.Start}
+	if !period.End.IsZero() {
+		state.PeriodEnd = &period.End
+	}
+
+	state.Progress = periodProgress(period, completions)
+	if state.Progress >= completionTarget(target) {
+		state.Status = TaskStatusDone
+	}
+
+	return state
+}
+
+// completionTarget returns the quantity to log in a period for a task to be
+// done, tasks without a quantity being done after a single completion
+func completionTarget(quantity int) int {
+	return max(quantity, 1)
+}
+
+func periodProgress(period Period, completions []TaskCompletion) int {
+	progress := 0
+	for _, completion := range completions {
+		if period.Contains(completion.CompletedAt) {
+			progress += completion.Quantity
+		}
+	}
+	return progress
+}
+
 type TaskFilter struct {
-	Name              *string
-	Description       *string
-	Categories        []string
-	UserID            *string
-	Completed         *bool
+	Name        *string
+	Description *string
+	// Categories are category IDs, tasks in any of them being selected
+	Categories []string
+	UserID     *string
+	Completed  *bool
+	// Tasks completed between CompletionTimeMin included and CompletionTimeMax
+	// excluded are selected
 	CompletionTimeMin *time.Time
 	CompletionTimeMax *time.Time
+	// Public selects the public catalog when true and the tasks tracked by
+	// the user when false, both are returned when nil
+	Public *bool
+	// Archived selects archived tasks instead of active ones when true
+	Archived *bool
+	// Now is the time the completion state is evaluated at, its location is
+	// used to determine the current period
+	Now time.Time
 }
 
 type TaskSortBy string
@@ -116,16 +233,101 @@ const (
 	TaskSortByCompletionTime TaskSortBy = "complete_timestamp"
 )
 
-func FetchOneTask(conn *sql.Tx, taskID string) (Task, error) {
+// FetchOneTask fetches a task along with the tracking information of a user
+func FetchOneTask(conn *sql.Tx, taskID string, userID string) (Task, error) {
 	var task taskFromQuery
-	row := conn.QueryRow("select task.task_id, quantity, unit, name, description, frequency, experience_gained, is_public, user_id from task left join user_task on user_task.task_id = task.task_id where task.task_id = $1", taskID)
-	err := row.Scan(&task.TaskID, &task.Quantity, &task.Unit, &task.Name, &task.Description, &task.Frequency, &task.ExperienceGained, &task.IsPublic, &task.UserID)
+	row := conn.QueryRow("select task.task_id, quantity, unit, name, description, frequency, experience_gained, is_public, owner_id, user_task_id, archived_at from task left join user_task on user_task.task_id = task.task_id and user_task.user_id = $2 where task.task_id = $1", taskID, userID)
+	err := row.Scan(&task.TaskID, &task.Quantity, &task.Unit, &task.Name, &task.Description, &task.Frequency, &task.ExperienceGained, &task.IsPublic, &task.UserID, &task.UserTaskID, &task.ArchivedAt)
 
 	if err != nil {
 		return Task{}, err
 	}
 
-	return makeTask(task), nil
+	tasks := []Task{makeTask(task)}
+	if err := fetchTasksCategories(conn, tasks); err != nil {
+		return Task{}, err
+	}
+
+	return tasks[0], nil
+}
+
+// FetchTaskStates fills the State and Streak of the given tasks that are
+// tracked by a user, as seen at the given time
+func FetchTaskStates(conn *sql.Tx, tasks []Task, at time.Time) error {
+	userTaskIDs := make([]string, 0, len(tasks))
+	since := at
+	for _, task := range tasks {
+		if task.userTaskID == nil {
+			continue
+		}
+
+		userTaskIDs = append(userTaskIDs, *task.userTaskID)
+		if period, ok := task.Frequency.PeriodAt(at); ok && period.Start.Before(since) {
+			since = period.Start
+		}
+	}
+
+	if len(userTaskIDs) == 0 {
+		return nil
+	}
+
+	rows, err := conn.Query("select user_task_id, complete_timestamp, quantity from task_completion where user_task_id = any($1) and complete_timestamp >= $2", pq.Array(userTaskIDs), since.UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	completions := make(map[string][]TaskCompletion)
+	for rows.Next() {
+		var userTaskID string
+		var completion TaskCompletion
+		if err := rows.Scan(&userTaskID, &completion.CompletedAt, &completion.Quantity); err != nil {
+			return err
+		}
+		completions[userTaskID] = append(completions[userTaskID], completion)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	type streakFromQuery struct {
+		streak          TaskStreak
+		lastPeriodStart *time.Time
+	}
+
+	rows, err = conn.Query("select user_task_id, current_streak, longest_streak, streak_period_start from user_task where user_task_id = any($1)", pq.Array(userTaskIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	streaks := make(map[string]streakFromQuery)
+	for rows.Next() {
+		var userTaskID string
+		var streak streakFromQuery
+		if err := rows.Scan(&userTaskID, &streak.streak.Current, &streak.streak.Longest, &streak.lastPeriodStart); err != nil {
+			return err
+		}
+		streaks[userTaskID] = streak
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range tasks {
+		if tasks[i].userTaskID == nil {
+			continue
+		}
+
+		state := makeTaskState(tasks[i].Frequency, tasks[i].Quantity, completions[*tasks[i].userTaskID], at)
+		tasks[i].State = &state
+
+		stored := streaks[*tasks[i].userTaskID]
+		streak := currentStreak(stored.streak, stored.lastPeriodStart, tasks[i].Frequency, at)
+		tasks[i].Streak = &streak
+	}
+
+	return nil
 }
 
 func CountTasks(conn *sql.Tx) (int, error) {
@@ -134,141 +336,149 @@ func CountTasks(conn *sql.Tx) (int, error) {
 	return count, err
 }
 
+// CountOwnedTasks counts the custom tasks created by a user which are not archived
+func CountOwnedTasks(conn *sql.Tx, userID string) (int, error) {
+	var count int
+	err := conn.QueryRow("select count(*) from task inner join user_task on user_task.task_id = task.task_id and user_task.user_id = task.owner_id where task.owner_id = $1 and user_task.archived_at is null", userID).Scan(&count)
+	return count, err
+}
+
 func FetchAllTasks(conn *sql.Tx, filter TaskFilter, sortBy *TaskSortBy, limit int, offset int) ([]Task, int, error) {
 	var tasks []Task
 	tasks = make([]Task, 0)
 
-	query := "select task.task_id, quantity, unit, name, description, frequency, experience_gained, is_public, user_id from task"
-	joins := " left join user_task on task.task_id = user_task.task_id"
+	query := "select task.task_id, quantity, unit, name, description, frequency, experience_gained, is_public, owner_id, user_task_id, archived_at from task"
+	joins := " left join user_task on task.task_id = user_task.task_id and user_task.user_id = $1"
 	where := ""
-	paramIndex := 1
+	args := make([]interface{}, 0)
+
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+	} else {
+		joins = " left join user_task on false"
+	}
 
 	if filter.Name != nil {
-		where += " and name like $" + strconv.Itoa(paramIndex)
-		paramIndex++
+		args = append(args, "%"+*filter.Name+"%")
+		where += " and name like $" + strconv.Itoa(len(args))
 	}
 
 	if filter.Description != nil {
-		where += " and description like $" + strconv.Itoa(paramIndex)
-		paramIndex++
+		args = append(args, "%"+*filter.Description+"%")
+		where += " and description like $" + strconv.Itoa(len(args))
 	}
 
 	if len(filter.Categories) > 0 {
-		joins += " inner join task_category on task.task_id = task_category.category_id inner join category on task_category.category_id = category.category_id"
-		where += " and category.name in ("
-		for i, _ := range filter.Categories {
+		where += " and exists (select 1 from task_category where task_category.task_id = task.task_id and task_category.category_id in ("
+		for i := range filter.Categories {
 			if i > 0 {
 				where += ", "
 			}
-			where += "$" + strconv.Itoa(paramIndex)
-			paramIndex++
+			args = append(args, filter.Categories[i])
+			where += "$" + strconv.Itoa(len(args))
 		}
-		where += ")"
+		where += "))"
 	}
 
-	if filter.UserID != nil {
-		where += " and (is_public = true or user_task.user_id = $" + strconv.Itoa(paramIndex) + ")"
-		paramIndex++
-	} else {
+	if filter.Public != nil && *filter.Public {
 		where += " and is_public = true"
+	} else if filter.Public != nil {
+		where += " and user_task.user_task_id is not null"
+	} else {
+		where += " and (is_public = true or user_task.user_task_id is not null)"
 	}
 
-	completionTimeJoin := filter.CompletionTimeMin != nil || filter.CompletionTimeMax != nil || filter.Completed != nil
-	completionTimeJoin = completionTimeJoin || (sortBy != nil && *sortBy == TaskSortByCompletionTime)
-	if completionTimeJoin {
-		joins += " left join task_completion on user_task.user_task_id = task_completion.user_task_id"
-		if filter.Completed == nil {
-			if filter.CompletionTimeMin != nil {
-				where += " and task_completion.complete_timestamp >= $" + strconv.Itoa(paramIndex)
-				paramIndex++
-			}
-			if filter.CompletionTimeMax != nil {
-				where += " and task_completion.complete_timestamp <= $" + strconv.Itoa(paramIndex)
-				paramIndex++
-			}
-		} else {
-			if *filter.Completed {
-				where += " and task_completion.complete_timestamp is not null"
-			} else {
-				where += " and task_completion.complete_timestamp is null"
-			}
-		}
+	if filter.Archived != nil && *filter.Archived {
+		where += " and user_task.archived_at is not null"
+	} else {
+		where += " and user_task.archived_at is null"
 	}
 
-	if where != "" {
-		query += joins + " where" + where[4:]
+	if filter.CompletionTimeMin != nil || filter.CompletionTimeMax != nil {
+		where += " and exists (select 1 from task_completion where task_completion.user_task_id = user_task.user_task_id"
+		if filter.CompletionTimeMin != nil {
+			args = append(args, filter.CompletionTimeMin.UTC())
+			where += " and task_completion.complete_timestamp >= $" + strconv.Itoa(len(args))
+		}
+		if filter.CompletionTimeMax != nil {
+			args = append(args, filter.CompletionTimeMax.UTC())
+			where += " and task_completion.complete_timestamp < $" + strconv.Itoa(len(args))
+		}
+		where += ")"
 	}
 
+	query += joins + " where" + where[4:]
+
 	if sortBy != nil {
 		switch *sortBy {
 		case TaskSortByCompletionTime:
-			query += " order by task_completion.complete_timestamp desc"
+			query += " order by (select max(complete_timestamp) from task_completion where task_completion.user_task_id = user_task.user_task_id) desc nulls last"
 		default:
 			query += " order by name"
 		}
 	}
-	query += " limit $" + strconv.Itoa(paramIndex) + " offset $" + strconv.Itoa(paramIndex+1)
-	args := make([]interface{}, paramIndex+1)
-	paramIndex = 0
 
-	if filter.Name != nil {
-		args[paramIndex] = "%" + *filter.Name + "%"
-		paramIndex++
+	// The completion state depends on each task's frequency, so filtering on it
+	// can only be done once every matching task has been fetched
+	paginate := filter.Completed == nil
+	queryArgs := args
+	if paginate {
+		query += " limit $" + strconv.Itoa(len(args)+1) + " offset $" + strconv.Itoa(len(args)+2)
+		queryArgs = append(append([]interface{}{}, args...), limit, offset)
 	}
 
-	if filter.Description != nil {
-		args[paramIndex] = "%" + *filter.Description + "%"
-		paramIndex++
-	}
-
-	for i, _ := range filter.Categories {
-		args[paramIndex] = filter.Categories[i]
-		paramIndex++
+	rows, err := conn.Query(query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer rows.Close()
 
-	if filter.UserID != nil {
-		args[paramIndex] = *filter.UserID
-		paramIndex++
-	}
+	for rows.Next() {
+		var task taskFromQuery
+		err := rows.Scan(&task.TaskID, &task.Quantity, &task.Unit, &task.Name, &task.Description, &task.Frequency, &task.ExperienceGained, &task.IsPublic, &task.UserID, &task.UserTaskID, &task.ArchivedAt)
 
-	if filter.Completed != nil {
-		if filter.CompletionTimeMin != nil {
-			args[paramIndex] = filter.CompletionTimeMin
-			paramIndex++
+		if err != nil {
+			return nil, 0, err
 		}
 
-		if filter.CompletionTimeMax != nil {
-			args[paramIndex] = filter.CompletionTimeMax
-			paramIndex++
-		}
+		tasks = append(tasks, makeTask(task))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	args[paramIndex] = limit
-	args[paramIndex+1] = offset
+	now := filter.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
 
-	fmt.Println(query, args)
+	if err := FetchTaskStates(conn, tasks, now); err != nil {
+		return nil, 0, err
+	}
 
-	rows, err := conn.Query(query, args...)
-	if err != nil {
+	if err := fetchTasksCategories(conn, tasks); err != nil {
 		return nil, 0, err
 	}
 
-	for rows.Next() {
-		var task taskFromQuery
-		err := rows.Scan(&task.TaskID, &task.Quantity, &task.Unit, &task.Name, &task.Description, &task.Frequency, &task.ExperienceGained, &task.IsPublic, &task.UserID)
+	if !paginate {
+		filtered := make([]Task, 0)
+		for _, task := range tasks {
+			if task.State == nil {
+				continue
+			}
 
-		if err != nil {
-			return nil, 0, err
+			if (*filter.Completed && task.State.Status == TaskStatusDone) || (!*filter.Completed && task.State.Status == TaskStatusDue) {
+				filtered = append(filtered, task)
+			}
 		}
 
-		tasks = append(tasks, makeTask(task))
+		total := len(filtered)
+		filtered = filtered[min(offset, total):min(offset+limit, total)]
+		return filtered, total, nil
 	}
 
-	query = "select count(*) from task" + joins + where
-	fmt.Println(query, args)
-
 	var total int
-	err = conn.QueryRow(query, args[:paramIndex]...).Scan(&total)
+	err = conn.QueryRow("select count(*) from task"+joins+" where"+where[4:], args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -276,21 +486,37 @@ func FetchAllTasks(conn *sql.Tx, filter TaskFilter, sortBy *TaskSortBy, limit in
 	return tasks, total, nil
 }
 
+// CreateTask creates a task, which is tracked by its owner if it has one
 func CreateTask(conn *sql.Tx, task Task) error {
 	var t = makeTaskFromQuery(task)
-	fmt.Println(task)
-	_, err := conn.Exec("insert into task (task_id, quantity, unit, name, description, frequency, experience_gained, is_public) values ($1, $2, $3, $4, $5, $6, $7, $8)",
-		t.TaskID, t.Quantity, t.Unit, t.Name, t.Description, t.Frequency, t.ExperienceGained, t.IsPublic)
+	_, err := conn.Exec("insert into task (task_id, quantity, unit, name, description, frequency, experience_gained, is_public, owner_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		t.TaskID, t.Quantity, t.Unit, t.Name, t.Description, t.Frequency, t.ExperienceGained, t.IsPublic, t.UserID)
 	if err != nil {
 		return err
 	}
 	if task.UserID != nil {
-		fmt.Println(*task.UserID, t.TaskID)
 		_, err = conn.Exec("insert into user_task (user_id, task_id) values ($1, $2)", *task.UserID, t.TaskID)
 	}
 	return err
 }
 
+// AdoptTask makes a user track a public task, with its own completion history
+func AdoptTask(conn *sql.Tx, userID string, taskID string) error {
+	result, err := conn.Exec("insert into user_task (user_id, task_id) values ($1, $2) on conflict (user_id, task_id) do nothing", userID, taskID)
+	if err != nil {
+		return err
+	}
+
+	adopted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if adopted == 0 {
+		return ErrTaskAlreadyTracked
+	}
+	return nil
+}
+
 func UpdateTask(conn *sql.Tx, task Task) error {
 	var t = makeTaskFromQuery(task)
 	_, err := conn.Exec("update task set quantity = $2, unit = $3, name = $4, description = $5, frequency = $6, experience_gained = $7, is_public = $8 where task_id = $1",
@@ -298,32 +524,197 @@ func UpdateTask(conn *sql.Tx, task Task) error {
 	return err
 }
 
-func CompleteTask(conn *sql.Tx, userID string, taskID string, completionTime time.Time) error {
-	row := conn.QueryRow("select user_task_id, experience_gained from user_task inner join task on task.task_id = user_task.task_id where user_task.task_id = $1 and user_task.user_id = $2", taskID, userID)
+// ArchiveTask hides a task from a user while keeping its completion history
+// and the experience it earned
+func ArchiveTask(conn *sql.Tx, userID string, taskID string, archivedAt time.Time) error {
+	_, err := conn.Exec("update user_task set archived_at = $3 where task_id = $1 and user_id = $2 and archived_at is null", taskID, userID, archivedAt.UTC())
+	return err
+}
+
+func RestoreTask(conn *sql.Tx, userID string, taskID string) error {
+	_, err := conn.Exec("update user_task set archived_at = null where task_id = $1 and user_id = $2", taskID, userID)
+	return err
+}
+
+// TaskProgress is the outcome of logging progress on a task
+type TaskProgress struct {
+	Completion TaskCompletion `json:"completion"`
+	Progress   int            `json:"progress"`
+	Target     int            `json:"target"`
+	Completed  bool           `json:"completed"`
+	Streak     TaskStreak     `json:"streak"`
+	// StreakFreezeUsed is true when a streak freeze kept the streak going
+	StreakFreezeUsed bool `json:"streak_freeze_used"`
+}
+
+// addProgress adds a quantity to the progress made in a period, a zero quantity
+// meaning the rest of the target, and returns the experience it awards. Only
+// the share of the target reached awards experience, so that the periods are
+// worth experienceGained once completed whatever the number of steps.
+func addProgress(progress int, target int, quantity int, experienceGained int) (TaskProgress, int, error) {
+	if progress >= target {
+		return TaskProgress{}, 0, ErrTaskAlreadyCompleted
+	}
+
+	if quantity == 0 {
+		quantity = target - progress
+	}
+
+	counted := min(quantity, target-progress)
+	experience := experienceGained*(progress+counted)/target - experienceGained*progress/target
+
+	return TaskProgress{
+		Progress:  progress + quantity,
+		Target:    target,
+		Completed: progress+quantity >= target,
+	}, experience, nil
+}
+
+// CompleteTask logs whatever quantity is left for a user to complete a task in
+// the current period. The completion time is interpreted in its location.
+func CompleteTask(conn *sql.Tx, userID string, taskID string, completion TaskCompletion) (TaskProgress, error) {
+	completion.Quantity = 0
+	return logTaskProgress(conn, userID, taskID, completion)
+}
+
+// LogTaskProgress logs a partial quantity done by a user on a task, which is
+// completed once the quantities logged in the current period reach its target.
+// The completion time is interpreted in its location.
+func LogTaskProgress(conn *sql.Tx, userID string, taskID string, completion TaskCompletion) (TaskProgress, error) {
+	if completion.Quantity <= 0 {
+		return TaskProgress{}, ErrInvalidQuantity
+	}
+	return logTaskProgress(conn, userID, taskID, completion)
+}
+
+// logTaskProgress records a completion, a zero quantity meaning the rest of the
+// target. Experience is awarded in proportion of the target reached, and the
+// streak is extended when the period gets completed.
+func logTaskProgress(conn *sql.Tx, userID string, taskID string, completion TaskCompletion) (TaskProgress, error) {
+	// Locking the user task makes concurrent completions of the same task wait
+	// for each other, so that a period is only completed once
+	row := conn.QueryRow("select user_task_id, quantity, unit, experience_gained, frequency, archived_at from user_task inner join task on task.task_id = user_task.task_id where user_task.task_id = $1 and user_task.user_id = $2 for update of user_task", taskID, userID)
 
 	var userTaskID string
+	var quantity int
+	var rawUnit string
 	var experienceGained int
-	err := row.Scan(&userTaskID, &experienceGained)
+	var rawFrequency string
+	var archivedAt *time.Time
+	err := row.Scan(&userTaskID, &quantity, &rawUnit, &experienceGained, &rawFrequency, &archivedAt)
+	if err == sql.ErrNoRows {
+		return TaskProgress{}, ErrTaskNotTracked
+	}
 	if err != nil {
-		return err
+		return TaskProgress{}, err
+	}
+
+	if archivedAt != nil {
+		return TaskProgress{}, ErrTaskArchived
+	}
+
+	frequency := parseStoredFrequency(rawFrequency)
+	period, ok := frequency.PeriodAt(completion.CompletedAt)
+	if !ok {
+		return TaskProgress{}, ErrTaskNotDue
 	}
 
-	_, err = conn.Exec("insert into task_completion (user_task_id, complete_timestamp) values ($1, $2)", userTaskID, completionTime)
+	query := "select coalesce(sum(quantity), 0) from task_completion where user_task_id = $1 and complete_timestamp >= $2"
+	args := []interface{}{userTaskID, period.Start.UTC()}
+	if !period.End.IsZero() {
+		query += " and complete_timestamp < $3"
+		args = append(args, period.End.UTC())
+	}
+
+	var progress int
+	err = conn.QueryRow(query, args...).Scan(&progress)
 	if err != nil {
-		return err
+		return TaskProgress{}, err
 	}
 
-	row = conn.QueryRow("select rank from user_experience where user_id = $1", userID)
+	result, experience, err := addProgress(progress, completionTarget(quantity), completion.Quantity, experienceGained)
+	if err != nil {
+		return TaskProgress{}, err
+	}
 
-	var rank float64
-	err = row.Scan(&rank)
+	if completion.Quantity == 0 {
+		completion.Quantity = result.Progress - progress
+	} else if err := unitValues[rawUnit].ValidateQuantity(completion.Quantity); err != nil {
+		return TaskProgress{}, err
+	}
+
+	streak, lastPeriodStart, err := fetchStreak(conn, userTaskID)
 	if err != nil {
-		return err
+		return TaskProgress{}, err
 	}
 
-	nextRankThreshold := math.Floor(rank) * 1000
-	rank += float64(experienceGained) / nextRankThreshold
+	bonus := 0
+
+	if result.Completed {
+		// A single missed period is forgiven by spending a streak freeze
+		if frequency.IsRecurring() && lastPeriodStart != nil && streak.Current > 0 {
+			if missed, ok := missedPeriod(frequency, *lastPeriodStart, period); ok {
+				result.StreakFreezeUsed, err = ConsumeInventoryItem(conn, userID, InventoryStreakFreeze)
+				if err != nil {
+					return TaskProgress{}, err
+				}
+				if result.StreakFreezeUsed {
+					lastPeriodStart = &missed.Start
+				}
+			}
+		}
 
-	_, err = conn.Exec("update user_experience set rank = $1 where user_id = $2", rank, userID)
-	return err
+		streak = extendStreak(streak, lastPeriodStart, frequency, period)
+		err = updateStreak(conn, userTaskID, streak, period.Start)
+		if err != nil {
+			return TaskProgress{}, err
+		}
+
+		bonus = milestoneBonus(streak.Current)
+	} else {
+		streak = currentStreak(streak, lastPeriodStart, frequency, completion.CompletedAt)
+	}
+
+	completion.CompletionID = uuid.New().String()
+	completion.TaskID = taskID
+	completion.ExperienceGained = experience + bonus
+	completion.Completed = result.Completed
+
+	err = createTaskCompletion(conn, userTaskID, completion)
+	if err != nil {
+		return TaskProgress{}, err
+	}
+
+	result.Completion = completion
+	result.Streak = streak
+
+	if experience != 0 {
+		_, err = AddExperience(conn, ExperienceEntry{
+			UserID:      userID,
+			Amount:      int64(experience),
+			Source:      ExperienceSourceTaskCompletion,
+			ReferenceID: &completion.CompletionID,
+			CreatedAt:   completion.CompletedAt,
+		})
+		if err != nil {
+			return TaskProgress{}, err
+		}
+	}
+
+	if bonus != 0 {
+		note := fmt.Sprintf("Streak of %d", streak.Current)
+		_, err = AddExperience(conn, ExperienceEntry{
+			UserID:      userID,
+			Amount:      int64(bonus),
+			Source:      ExperienceSourceBonus,
+			ReferenceID: &completion.CompletionID,
+			Note:        &note,
+			CreatedAt:   completion.CompletedAt,
+		})
+		if err != nil {
+			return TaskProgress{}, err
+		}
+	}
+
+	return result, nil
 }
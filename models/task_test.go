@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddProgressCompletesOnce(t *testing.T) {
+	tests := []struct {
+		name             string
+		target           int
+		experienceGained int
+	}{
+		{"task without quantity", 1, 100},
+		{"task with a quantity", 5000, 150},
+	}
+
+	for _, test := range tests {
+		first, experience, err := addProgress(0, test.target, 0, test.experienceGained)
+		if err != nil {
+			t.Fatalf("%s: first completion returned %v", test.name, err)
+		}
+		if !first.Completed || first.Progress != test.target || experience != test.experienceGained {
+			t.Errorf("%s: first completion = %+v and %d experience, want the target and %d experience", test.name, first, experience, test.experienceGained)
+		}
+
+		// A second completion in the same period sees the progress of the first
+		second, experience, err := addProgress(first.Progress, test.target, 0, test.experienceGained)
+		if !errors.Is(err, ErrTaskAlreadyCompleted) {
+			t.Errorf("%s: second completion returned %v, want %v", test.name, err, ErrTaskAlreadyCompleted)
+		}
+		if second.Completed || experience != 0 {
+			t.Errorf("%s: second completion = %+v and %d experience, want nothing", test.name, second, experience)
+		}
+	}
+}
+
+func TestAddProgressPartial(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     int
+		quantities []int
+		// experience awarded by each quantity, for 100 experience per period
+		want []int
+	}{
+		{"halves", 10, []int{5, 5}, []int{50, 50}},
+		{"crossing the target", 10, []int{6, 6}, []int{60, 40}},
+		{"thirds", 3, []int{1, 1, 1}, []int{33, 33, 34}},
+		{"rest of the target", 10, []int{3, 0}, []int{30, 70}},
+		{"beyond the target", 10, []int{25}, []int{100}},
+	}
+
+	for _, test := range tests {
+		progress := 0
+		total := 0
+		for i, quantity := range test.quantities {
+			result, experience, err := addProgress(progress, test.target, quantity, 100)
+			if err != nil {
+				t.Fatalf("%s: step %d returned %v", test.name, i, err)
+			}
+			if experience != test.want[i] {
+				t.Errorf("%s: step %d awarded %d experience, want %d", test.name, i, experience, test.want[i])
+			}
+			progress = result.Progress
+			total += experience
+		}
+
+		if total != 100 {
+			t.Errorf("%s: awarded %d experience in total, want 100", test.name, total)
+		}
+
+		// Progress logged once the target is reached awards nothing
+		if _, experience, err := addProgress(progress, test.target, 1, 100); !errors.Is(err, ErrTaskAlreadyCompleted) || experience != 0 {
+			t.Errorf("%s: progress after completion returned %d experience and %v", test.name, experience, err)
+		}
+	}
+}
@@ -2,13 +2,20 @@ package models
 
 import (
 	"database/sql"
-	"encoding/json"
+	"server/leveling"
+	"time"
 )
 
 type User struct {
-	UserID      string  `json:"id"`
-	CloudIamSub string  `json:"cloud_iam_sub"`
-	Rank        float32 `json:"rank"`
+	UserID            string  `json:"id"`
+	CloudIamSub       string  `json:"cloud_iam_sub"`
+	Rank              float32 `json:"rank"`
+	Experience        int64   `json:"experience"`
+	Timezone          string  `json:"timezone"`
+	LeaderboardOptOut bool    `json:"leaderboard_opt_out"`
+	// SubscriptionStatus is the status of the latest subscription, nil if none
+	SubscriptionStatus *SubscriptionStatus `json:"subscription_status"`
+	Premium            bool                `json:"premium"`
 }
 
 type UserSortBy string
@@ -17,32 +24,49 @@ const (
 	UserSortByRank UserSortBy = "rank"
 )
 
-func FetchOneUser(conn *sql.Tx, userID string) (User, error) {
+const selectUser = "select u.user_id, u.cloud_iam_sub, ue.experience, u.timezone, u.leaderboard_opt_out, s.status from \"user\" u inner join user_experience ue on u.user_id = ue.user_id" +
+	" left join lateral (select status from subscription where subscription.user_id = u.user_id order by created_at desc limit 1) s on true"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (User, error) {
 	var user User
-	row := conn.QueryRow("select u.user_id, u.cloud_iam_sub, ue.rank from \"user\" u inner join user_experience ue on u.user_id = ue.user_id where u.user_id = $1", userID)
-	err := row.Scan(&user.UserID, &user.CloudIamSub, &user.Rank)
+	err := row.Scan(&user.UserID, &user.CloudIamSub, &user.Experience, &user.Timezone, &user.LeaderboardOptOut, &user.SubscriptionStatus)
+	user.Rank = leveling.Rank(user.Experience)
+	user.Premium = user.SubscriptionStatus != nil && user.SubscriptionStatus.IsPremium()
 	return user, err
 }
 
+func FetchOneUser(conn *sql.Tx, userID string) (User, error) {
+	return scanUser(conn.QueryRow(selectUser+" where u.user_id = $1", userID))
+}
+
 func FetchOneUserByCloudIamSub(conn *sql.Tx, cloudIamSub string) (User, error) {
-	var user User
-	row := conn.QueryRow("select u.user_id, u.cloud_iam_sub, ue.rank from \"user\" u inner join user_experience ue on u.user_id = ue.user_id where cloud_iam_sub = $1", cloudIamSub)
-	err := row.Scan(&user.UserID, &user.CloudIamSub, &user.Rank)
-	return user, err
+	return scanUser(conn.QueryRow(selectUser+" where cloud_iam_sub = $1", cloudIamSub))
+}
+
+// FetchOneUserByStripeCustomerID returns the user linked to a Stripe customer
+func FetchOneUserByStripeCustomerID(conn *sql.Tx, customerID string) (User, error) {
+	return scanUser(conn.QueryRow(selectUser+" where u.stripe_customer_id = $1", customerID))
 }
 
 func CountUsers(conn *sql.Tx) (int, error) {
 	var count int
-	err := conn.QueryRow("select count(*) from user").Scan(&count)
+	err := conn.QueryRow("select count(*) from \"user\"").Scan(&count)
 	return count, err
 }
 
 func FetchAllUsers(conn *sql.Tx, sortBy *UserSortBy, limit int, offset int) ([]User, error) {
-	var users []User
+	users := make([]User, 0)
 
-	query := "select u.user_id, u.cloud_iam_sub, ue.rank from \"user\" u inner join ue on u.user_id = ue.user_id"
+	query := selectUser
 	if sortBy != nil {
-		query += " order by " + string(*sortBy)
+		switch *sortBy {
+		case UserSortByRank:
+			query += " order by ue.experience desc, u.user_id"
+		}
 	}
 	query += " limit $1 offset $2"
 
@@ -50,10 +74,10 @@ func FetchAllUsers(conn *sql.Tx, sortBy *UserSortBy, limit int, offset int) ([]U
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var user User
-		err = rows.Scan(&user.UserID, &user.CloudIamSub, &user.Rank)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -61,29 +85,49 @@ func FetchAllUsers(conn *sql.Tx, sortBy *UserSortBy, limit int, offset int) ([]U
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
 func CreateUser(conn *sql.Tx, user User) error {
-	_, err := conn.Exec("insert into \"user\" (user_id, cloud_iam_sub) values ($1, $2)", user.UserID, user.CloudIamSub)
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+
+	_, err := conn.Exec("insert into \"user\" (user_id, cloud_iam_sub, timezone) values ($1, $2, $3)", user.UserID, user.CloudIamSub, user.Timezone)
 	if err != nil {
 		return err
 	}
 
-	_, err = conn.Exec("insert into user_experience (user_id, rank) values ($1, $2)", user.UserID, user.Rank)
+	_, err = conn.Exec("insert into user_experience (user_id, experience) values ($1, 0)", user.UserID)
 	return err
 }
 
+// Update updates the profile of a user, experience being changed through AddExperience only
 func Update(conn *sql.Tx, user User) error {
-	_, err := conn.Exec("update \"user\" set cloud_iam_sub = $1 where user_id = $2", user.CloudIamSub, user.UserID)
-	if err != nil {
-		return err
-	}
+	_, err := conn.Exec("update \"user\" set cloud_iam_sub = $1, timezone = $2, leaderboard_opt_out = $3 where user_id = $4", user.CloudIamSub, user.Timezone, user.LeaderboardOptOut, user.UserID)
+	return err
+}
+
+// FetchStripeCustomerID returns the Stripe customer of a user, nil if none
+// was created yet, locking the user until the end of the transaction so that
+// a single customer gets created
+func FetchStripeCustomerID(conn *sql.Tx, userID string) (*string, error) {
+	var customerID *string
+	err := conn.QueryRow("select stripe_customer_id from \"user\" where user_id = $1 for update", userID).Scan(&customerID)
+	return customerID, err
+}
 
-	_, err = conn.Exec("update user_experience set rank = $1 where user_id = $2", user.Rank, user.UserID)
+// LinkStripeCustomer sets the Stripe customer of a user if they have none
+func LinkStripeCustomer(conn *sql.Tx, userID string, customerID string) error {
+	_, err := conn.Exec("update \"user\" set stripe_customer_id = $2 where user_id = $1 and stripe_customer_id is null", userID, customerID)
 	return err
 }
 
-func (i User) MarshalBinary() ([]byte, error) {
-	return json.Marshal(i)
+// Location returns the timezone of the user, defaulting to UTC
+func (user User) Location() *time.Location {
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
@@ -0,0 +1,295 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"server/common"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/webhook"
+)
+
+// Amount charged per unit by the fake provider, in cents
+const fakeUnitAmount = 100
+
+var (
+	ErrUnknownSession = errors.New("unknown checkout session")
+	ErrSessionState   = errors.New("invalid checkout session state")
+)
+
+// FakeLineItem is a price bought with a fake checkout session
+type FakeLineItem struct {
+	Price    string `json:"price"`
+	Quantity int64  `json:"quantity"`
+}
+
+// FakeSession is a checkout session of the fake provider, kept in memory
+type FakeSession struct {
+	ID                   string            `json:"id"`
+	Mode                 string            `json:"mode"`
+	Status               string            `json:"status"`
+	CustomerID           string            `json:"customer"`
+	ClientReferenceID    string            `json:"client_reference_id"`
+	Metadata             map[string]string `json:"metadata"`
+	SubscriptionMetadata map[string]string `json:"-"`
+	LineItems            []FakeLineItem    `json:"line_items"`
+	AmountTotal          int64             `json:"amount_total"`
+	SuccessURL           string            `json:"success_url"`
+	CancelURL            string            `json:"cancel_url"`
+	PaymentIntentID      string            `json:"payment_intent,omitempty"`
+	SubscriptionID       string            `json:"subscription,omitempty"`
+	Refunded             bool              `json:"refunded"`
+}
+
+// FakeProvider emulates Stripe locally: checkout sessions are completed by
+// developers through the dev endpoints, which makes the provider send the
+// corresponding signed events to the webhook.
+type FakeProvider struct {
+	mutex    sync.Mutex
+	sessions map[string]*FakeSession
+}
+
+var fake = &FakeProvider{sessions: make(map[string]*FakeSession)}
+
+func fakeID(prefix string) string {
+	return prefix + "_fake_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+func (f *FakeProvider) NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error) {
+	return &stripe.Customer{ID: fakeID("cus"), Metadata: params.Metadata}, nil
+}
+
+func (f *FakeProvider) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	sess := &FakeSession{
+		ID:       fakeID("cs"),
+		Mode:     stripe.StringValue(params.Mode),
+		Status:   "open",
+		Metadata: params.Metadata,
+	}
+	sess.CustomerID = stripe.StringValue(params.Customer)
+	sess.ClientReferenceID = stripe.StringValue(params.ClientReferenceID)
+	sess.SuccessURL = strings.ReplaceAll(stripe.StringValue(params.SuccessURL), "{CHECKOUT_SESSION_ID}", sess.ID)
+	sess.CancelURL = stripe.StringValue(params.CancelURL)
+	if params.SubscriptionData != nil {
+		sess.SubscriptionMetadata = params.SubscriptionData.Metadata
+	}
+	for _, lineItem := range params.LineItems {
+		quantity := stripe.Int64Value(lineItem.Quantity)
+		sess.LineItems = append(sess.LineItems, FakeLineItem{Price: stripe.StringValue(lineItem.Price), Quantity: quantity})
+		sess.AmountTotal += quantity * fakeUnitAmount
+	}
+
+	f.mutex.Lock()
+	f.sessions[sess.ID] = sess
+	f.mutex.Unlock()
+
+	return &stripe.CheckoutSession{
+		ID:  sess.ID,
+		URL: strings.TrimRight(common.Config.PublicBaseUrl, "/") + "/api/v1/dev/payments/checkout/" + sess.ID,
+	}, nil
+}
+
+func (f *FakeProvider) ListLineItems(sessionID string) ([]*stripe.LineItem, error) {
+	sess, ok := f.Session(sessionID)
+	if !ok {
+		return nil, ErrUnknownSession
+	}
+
+	lineItems := make([]*stripe.LineItem, len(sess.LineItems))
+	for i, lineItem := range sess.LineItems {
+		lineItems[i] = &stripe.LineItem{
+			ID:       fmt.Sprintf("li_fake_%s_%d", sess.ID, i),
+			Price:    &stripe.Price{ID: lineItem.Price},
+			Quantity: lineItem.Quantity,
+		}
+	}
+	return lineItems, nil
+}
+
+// NewPortalSession sends the user straight back, the fake provider having no
+// billing portal
+func (f *FakeProvider) NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error) {
+	return &stripe.BillingPortalSession{ID: fakeID("bps"), URL: stripe.StringValue(params.ReturnURL)}, nil
+}
+
+// Session returns a copy of a checkout session
+func (f *FakeProvider) Session(sessionID string) (FakeSession, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	sess, ok := f.sessions[sessionID]
+	if !ok {
+		return FakeSession{}, false
+	}
+	return *sess, true
+}
+
+// update applies a transition to an open or complete session, depending on
+// the state expected
+func (f *FakeProvider) update(sessionID string, status string, apply func(sess *FakeSession)) (FakeSession, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	sess, ok := f.sessions[sessionID]
+	if !ok {
+		return FakeSession{}, ErrUnknownSession
+	}
+	if sess.Status != status {
+		return FakeSession{}, ErrSessionState
+	}
+
+	apply(sess)
+	return *sess, nil
+}
+
+// Complete pays a checkout session, sending checkout.session.completed and,
+// for subscriptions, customer.subscription.created to the webhook
+func (f *FakeProvider) Complete(sessionID string) (FakeSession, error) {
+	sess, err := f.update(sessionID, "open", func(sess *FakeSession) {
+		sess.Status = "complete"
+		if sess.Mode == string(stripe.CheckoutSessionModeSubscription) {
+			sess.SubscriptionID = fakeID("sub")
+		} else {
+			sess.PaymentIntentID = fakeID("pi")
+		}
+	})
+	if err != nil {
+		return FakeSession{}, err
+	}
+
+	object := map[string]interface{}{
+		"id":                  sess.ID,
+		"object":              "checkout.session",
+		"mode":                sess.Mode,
+		"status":              "complete",
+		"payment_status":      "paid",
+		"amount_total":        sess.AmountTotal,
+		"currency":            "eur",
+		"customer":            sess.CustomerID,
+		"client_reference_id": sess.ClientReferenceID,
+		"metadata":            sess.Metadata,
+	}
+	if sess.PaymentIntentID != "" {
+		object["payment_intent"] = sess.PaymentIntentID
+	}
+	if sess.SubscriptionID != "" {
+		object["subscription"] = sess.SubscriptionID
+	}
+
+	if err := send(stripe.EventTypeCheckoutSessionCompleted, object); err != nil {
+		return sess, err
+	}
+
+	if sess.SubscriptionID != "" {
+		return sess, send(stripe.EventTypeCustomerSubscriptionCreated, fakeSubscription(sess, "active"))
+	}
+	return sess, nil
+}
+
+// Cancel abandons a checkout session, as when the user leaves the checkout
+func (f *FakeProvider) Cancel(sessionID string) (FakeSession, error) {
+	return f.update(sessionID, "open", func(sess *FakeSession) {
+		sess.Status = "expired"
+	})
+}
+
+// Refund refunds a paid checkout session (charge.refunded) or cancels its
+// subscription (customer.subscription.deleted)
+func (f *FakeProvider) Refund(sessionID string) (FakeSession, error) {
+	var alreadyRefunded bool
+	sess, err := f.update(sessionID, "complete", func(sess *FakeSession) {
+		alreadyRefunded = sess.Refunded
+		sess.Refunded = true
+	})
+	if err != nil {
+		return FakeSession{}, err
+	}
+	if alreadyRefunded {
+		return FakeSession{}, ErrSessionState
+	}
+
+	if sess.SubscriptionID != "" {
+		return sess, send(stripe.EventTypeCustomerSubscriptionDeleted, fakeSubscription(sess, "canceled"))
+	}
+
+	return sess, send(stripe.EventTypeChargeRefunded, map[string]interface{}{
+		"id":              fakeID("ch"),
+		"object":          "charge",
+		"amount":          sess.AmountTotal,
+		"amount_refunded": sess.AmountTotal,
+		"refunded":        true,
+		"currency":        "eur",
+		"customer":        sess.CustomerID,
+		"payment_intent":  sess.PaymentIntentID,
+	})
+}
+
+func fakeSubscription(sess FakeSession, status string) map[string]interface{} {
+	items := make([]map[string]interface{}, len(sess.LineItems))
+	for i, lineItem := range sess.LineItems {
+		items[i] = map[string]interface{}{
+			"id":                 fmt.Sprintf("si_fake_%s_%d", sess.SubscriptionID, i),
+			"object":             "subscription_item",
+			"quantity":           lineItem.Quantity,
+			"price":              map[string]interface{}{"id": lineItem.Price, "object": "price"},
+			"current_period_end": time.Now().AddDate(0, 1, 0).Unix(),
+		}
+	}
+
+	return map[string]interface{}{
+		"id":                   sess.SubscriptionID,
+		"object":               "subscription",
+		"status":               status,
+		"customer":             sess.CustomerID,
+		"cancel_at_period_end": false,
+		"created":              time.Now().Unix(),
+		"metadata":             sess.SubscriptionMetadata,
+		"items":                map[string]interface{}{"object": "list", "data": items},
+	}
+}
+
+// send delivers an event to the webhook of the server, signed like Stripe does
+func send(eventType stripe.EventType, object map[string]interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          fakeID("evt"),
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"created":     time.Now().Unix(),
+		"type":        eventType,
+		"livemode":    false,
+		"data":        map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		return err
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  common.Config.StripeWebhookSecret,
+	})
+
+	req, err := http.NewRequest("POST", strings.TrimRight(common.Config.PublicBaseUrl, "/")+"/api/v1/stripe/webhook", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", signed.Header)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook answered %s to %s", res.Status, eventType)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package payments
+
+import (
+	"server/common"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// Provider creates the Stripe objects the server needs. Events are received
+// on the webhook whatever the provider, signed with the webhook secret.
+type Provider interface {
+	NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error)
+	NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error)
+	ListLineItems(sessionID string) ([]*stripe.LineItem, error)
+	NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error)
+}
+
+var provider Provider
+
+// Init selects the provider denoted by PAYMENTS_PROVIDER
+func Init() {
+	if common.Config.PaymentsProvider == "fake" {
+		provider = fake
+	} else {
+		provider = stripeProvider{}
+	}
+}
+
+// Fake returns the fake provider, nil when payments go through Stripe
+func Fake() *FakeProvider {
+	if provider == fake {
+		return fake
+	}
+	return nil
+}
+
+func NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error) {
+	return provider.NewCustomer(params)
+}
+
+func NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return provider.NewCheckoutSession(params)
+}
+
+// ListLineItems returns every line item of a checkout session
+func ListLineItems(sessionID string) ([]*stripe.LineItem, error) {
+	return provider.ListLineItems(sessionID)
+}
+
+func NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error) {
+	return provider.NewPortalSession(params)
+}
@@ -0,0 +1,36 @@
+package payments
+
+import (
+	"github.com/stripe/stripe-go/v82"
+	portalsession "github.com/stripe/stripe-go/v82/billingportal/session"
+	"github.com/stripe/stripe-go/v82/checkout/session"
+	"github.com/stripe/stripe-go/v82/customer"
+)
+
+// stripeProvider goes through the Stripe API
+type stripeProvider struct{}
+
+func (stripeProvider) NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error) {
+	return customer.New(params)
+}
+
+func (stripeProvider) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return session.New(params)
+}
+
+func (stripeProvider) ListLineItems(sessionID string) ([]*stripe.LineItem, error) {
+	lineItems := make([]*stripe.LineItem, 0)
+
+	iter := session.ListLineItems(&stripe.CheckoutSessionListLineItemsParams{
+		Session: stripe.String(sessionID),
+	})
+	for iter.Next() {
+		lineItems = append(lineItems, iter.LineItem())
+	}
+
+	return lineItems, iter.Err()
+}
+
+func (stripeProvider) NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error) {
+	return portalsession.New(params)
+}
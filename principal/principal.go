@@ -0,0 +1,139 @@
+package principal
+
+import (
+	go_context "context"
+	"net/http"
+	"server/common"
+	"server/models"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Principal is the user an authenticated request is made on behalf of, put in
+// the context of the request by the Auth middleware
+type Principal struct {
+	UserID      string `json:"user_id"`
+	CloudIamSub string `json:"cloud_iam_sub"`
+	// Roles are the Keycloak realm roles of the user, along with their roles
+	// on the client of the backend
+	Roles       []string `json:"roles"`
+	DisplayName string   `json:"display_name"`
+	Email       string   `json:"email"`
+	Timezone    string   `json:"timezone"`
+	Premium     bool     `json:"premium"`
+	// AccessTokenID is the personal access token the request was made with,
+	// empty for Keycloak tokens, which are granted every scope
+	AccessTokenID string                    `json:"access_token_id,omitempty"`
+	Scopes        []models.AccessTokenScope `json:"scopes,omitempty"`
+}
+
+// New returns the principal of a user authenticated by the claims of an
+// access token
+func New(user models.User, claims jwt.MapClaims) Principal {
+	principal := Principal{
+		UserID:      user.UserID,
+		CloudIamSub: user.CloudIamSub,
+		Roles:       roles(claims),
+		Timezone:    user.Timezone,
+		Premium:     user.Premium,
+	}
+
+	principal.DisplayName, _ = claims["name"].(string)
+	if principal.DisplayName == "" {
+		principal.DisplayName, _ = claims["preferred_username"].(string)
+	}
+	principal.Email, _ = claims["email"].(string)
+
+	return principal
+}
+
+// FromAccessToken returns the principal of a user authenticated by one of
+// their personal access tokens, which carry no role
+func FromAccessToken(user models.User, token models.AccessToken) Principal {
+	return Principal{
+		UserID:        user.UserID,
+		CloudIamSub:   user.CloudIamSub,
+		Roles:         make([]string, 0),
+		Timezone:      user.Timezone,
+		Premium:       user.Premium,
+		AccessTokenID: token.TokenID,
+		Scopes:        token.Scopes,
+	}
+}
+
+// roles returns the realm roles of the claims and the client roles given on
+// KEYCLOAK_CLIENT_ID, in that order and without duplicates
+func roles(claims jwt.MapClaims) []string {
+	roles := accessRoles(claims["realm_access"])
+
+	if common.Config.JwtAuthorizedParty != "" {
+		resourceAccess, _ := claims["resource_access"].(map[string]interface{})
+		for _, role := range accessRoles(resourceAccess[common.Config.JwtAuthorizedParty]) {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return roles
+}
+
+// accessRoles returns the roles of a Keycloak access claim, i.e.
+// {"roles": [...]}
+func accessRoles(access interface{}) []string {
+	roles := make([]string, 0)
+
+	claim, ok := access.(map[string]interface{})
+	if !ok {
+		return roles
+	}
+
+	claimed, _ := claim["roles"].([]interface{})
+	for _, role := range claimed {
+		if role, ok := role.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// HasRole tells whether the principal has any of the given roles
+func (principal Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(principal.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope tells whether the principal was granted a scope
+func (principal Principal) HasScope(scope models.AccessTokenScope) bool {
+	return principal.AccessTokenID == "" || slices.Contains(principal.Scopes, scope)
+}
+
+// Location returns the timezone of the user, defaulting to UTC
+func (principal Principal) Location() *time.Location {
+	return models.User{Timezone: principal.Timezone}.Location()
+}
+
+type contextKey struct{}
+
+func NewContext(ctx go_context.Context, principal Principal) go_context.Context {
+	return go_context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal of an authenticated request
+func FromContext(ctx go_context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(Principal)
+	return principal, ok
+}
+
+// FromRequest returns the principal of a request wrapped by the Auth
+// middleware, the zero principal for anonymous requests
+func FromRequest(r *http.Request) Principal {
+	principal, _ := FromContext(r.Context())
+	return principal
+}
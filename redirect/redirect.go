@@ -0,0 +1,71 @@
+package redirect
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"server/common"
+	"strings"
+)
+
+// CheckoutSessionID is replaced by Stripe with the ID of the checkout session
+// in success URLs, so that the frontend can confirm the purchase
+const CheckoutSessionID = "{CHECKOUT_SESSION_ID}"
+
+var (
+	ErrInvalidURL         = errors.New("invalid redirect URL")
+	ErrOriginNotAllowed   = errors.New("redirect origin not allowed")
+	ErrInvalidPlaceholder = errors.New("invalid placeholder in redirect URL")
+)
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Resolve returns the URL users are redirected to, the fallback being used
+// when raw is empty. The URL must be absolute, on one of the allowed origins,
+// and only contain the given placeholders.
+func Resolve(raw string, fallback string, placeholders ...string) (string, error) {
+	if raw == "" {
+		raw = fallback
+	}
+
+	for _, placeholder := range placeholderPattern.FindAllString(raw, -1) {
+		allowed := false
+		for _, p := range placeholders {
+			allowed = allowed || placeholder == p
+		}
+		if !allowed {
+			return "", ErrInvalidPlaceholder
+		}
+	}
+
+	u, err := url.Parse(placeholderPattern.ReplaceAllString(raw, "placeholder"))
+	if err != nil || !u.IsAbs() || u.Host == "" || u.User != nil {
+		return "", ErrInvalidURL
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", ErrInvalidURL
+	}
+	// Placeholders are only allowed after the origin, which must be known
+	// before Stripe fills them in. The scheme being http(s), the origin spans
+	// the same bytes before and after the replacement.
+	if strings.Contains(raw[:len(u.Scheme)+len("://")+len(u.Host)], "{") {
+		return "", ErrInvalidPlaceholder
+	}
+
+	if !IsAllowedOrigin(u.Scheme + "://" + u.Host) {
+		return "", ErrOriginNotAllowed
+	}
+
+	return raw, nil
+}
+
+// IsAllowedOrigin reports whether an origin (scheme://host[:port]) is the
+// public base URL or one of the configured redirect origins
+func IsAllowedOrigin(origin string) bool {
+	for _, allowed := range common.Config.AllowedRedirectOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
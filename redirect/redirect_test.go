@@ -0,0 +1,53 @@
+package redirect
+
+import (
+	"server/common"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	common.Config.AllowedRedirectOrigins = []string{"https://app.example.com", "http://localhost:3000"}
+
+	tests := []struct {
+		name         string
+		raw          string
+		fallback     string
+		placeholders []string
+		want         string
+		err          error
+	}{
+		{name: "allowed origin", raw: "https://app.example.com/done", want: "https://app.example.com/done"},
+		{name: "allowed origin with a port", raw: "http://localhost:3000/done?ok=1", want: "http://localhost:3000/done?ok=1"},
+		{name: "trailing slash", raw: "https://app.example.com/", want: "https://app.example.com/"},
+		{name: "no path", raw: "https://app.example.com", want: "https://app.example.com"},
+		{name: "case in the origin", raw: "HTTPS://App.Example.COM/done", want: "HTTPS://App.Example.COM/done"},
+		{name: "fallback", raw: "", fallback: "https://app.example.com/checkout", want: "https://app.example.com/checkout"},
+		{name: "fallback with a placeholder", fallback: "https://app.example.com/checkout?session_id={CHECKOUT_SESSION_ID}", placeholders: []string{CheckoutSessionID}, want: "https://app.example.com/checkout?session_id={CHECKOUT_SESSION_ID}"},
+		{name: "placeholder in the path", raw: "https://app.example.com/checkout/{CHECKOUT_SESSION_ID}", placeholders: []string{CheckoutSessionID}, want: "https://app.example.com/checkout/{CHECKOUT_SESSION_ID}"},
+		{name: "unknown placeholder", raw: "https://app.example.com/?id={OTHER}", placeholders: []string{CheckoutSessionID}, err: ErrInvalidPlaceholder},
+		{name: "placeholder not given", raw: "https://app.example.com/?id={CHECKOUT_SESSION_ID}", err: ErrInvalidPlaceholder},
+		{name: "placeholder in the host", raw: "https://{CHECKOUT_SESSION_ID}.app.example.com/", placeholders: []string{CheckoutSessionID}, err: ErrInvalidPlaceholder},
+		{name: "placeholder after the host", raw: "https://app.example.com{CHECKOUT_SESSION_ID}/", placeholders: []string{CheckoutSessionID}, err: ErrInvalidPlaceholder},
+		{name: "user info", raw: "https://app.example.com@evil.example.com/", err: ErrInvalidURL},
+		{name: "user info on an allowed host", raw: "https://user@app.example.com/", err: ErrInvalidURL},
+		{name: "other origin", raw: "https://evil.example.com/", err: ErrOriginNotAllowed},
+		{name: "other port", raw: "https://app.example.com:8443/", err: ErrOriginNotAllowed},
+		{name: "other scheme", raw: "http://app.example.com/", err: ErrOriginNotAllowed},
+		{name: "javascript scheme", raw: "javascript:alert(1)", err: ErrInvalidURL},
+		{name: "ftp scheme", raw: "ftp://app.example.com/", err: ErrInvalidURL},
+		{name: "relative", raw: "/done", err: ErrInvalidURL},
+		{name: "scheme relative", raw: "//app.example.com/done", err: ErrInvalidURL},
+		{name: "empty", raw: "", fallback: "", err: ErrInvalidURL},
+	}
+
+	for _, test := range tests {
+		got, err := Resolve(test.raw, test.fallback, test.placeholders...)
+		if err != test.err {
+			t.Errorf("%s: Resolve(%q) returned error %v, want %v", test.name, test.raw, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: Resolve(%q) = %q, want %q", test.name, test.raw, got, test.want)
+		}
+	}
+}
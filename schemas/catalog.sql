@@ -0,0 +1,7 @@
+insert into task (quantity, unit, name, description, frequency, experience_gained, is_public) values
+	(5000, 'distance', 'Run 5 km', 'Go for a 5 km run', 'FREQ=WEEKLY;BYDAY=MO,WE,FR', 150, true),
+	(1800, 'time', 'Read for 30 minutes', 'Read a book for half an hour', 'daily', 100, true),
+	(50, 'reps', 'Push-ups', 'Do 50 push-ups', 'daily', 100, true),
+	(600, 'time', 'Meditate', 'Meditate for 10 minutes', 'daily', 75, true),
+	(0, 'none', 'Plan the week', 'Write down the goals of the upcoming week', 'FREQ=WEEKLY;BYDAY=SU', 100, true),
+	(0, 'none', 'Declutter a room', 'Tidy up and declutter one room of your home', 'monthly', 200, true);
@@ -0,0 +1 @@
+alter table "user" add column timezone text not null default 'UTC';
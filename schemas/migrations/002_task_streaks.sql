@@ -0,0 +1,3 @@
+alter table user_task add column current_streak int not null default 0;
+alter table user_task add column longest_streak int not null default 0;
+alter table user_task add column streak_period_start timestamp;
@@ -0,0 +1,11 @@
+alter table task_completion drop constraint task_completion_pkey;
+alter table task_completion add column completion_id uuid not null default gen_random_uuid();
+alter table task_completion add primary key (completion_id);
+alter table task_completion add column note text;
+alter table task_completion add column quantity int not null default 0;
+
+update task_completion set quantity = task.quantity
+from user_task inner join task on task.task_id = user_task.task_id
+where user_task.user_task_id = task_completion.user_task_id;
+
+create index task_completion_user_task_idx on task_completion (user_task_id, complete_timestamp);
@@ -0,0 +1,8 @@
+alter table task_completion add column experience_gained int not null default 0;
+
+update task_completion set experience_gained = task.experience_gained
+from user_task inner join task on task.task_id = user_task.task_id
+where user_task.user_task_id = task_completion.user_task_id;
+
+-- Tasks without a quantity are done once a quantity of 1 is logged
+update task_completion set quantity = 1 where quantity = 0;
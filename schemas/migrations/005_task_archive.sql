@@ -0,0 +1 @@
+alter table user_task add column archived_at timestamp;
@@ -0,0 +1 @@
+alter table category add column user_id uuid references "user"(user_id);
@@ -0,0 +1,7 @@
+alter table task add column owner_id uuid references "user"(user_id);
+
+update task set owner_id = user_task.user_id
+from user_task
+where user_task.task_id = task.task_id and task.is_public = false;
+
+alter table user_task add constraint user_task_user_id_task_id_key unique (user_id, task_id);
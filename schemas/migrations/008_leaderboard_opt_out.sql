@@ -0,0 +1 @@
+alter table "user" add column leaderboard_opt_out boolean not null default false;
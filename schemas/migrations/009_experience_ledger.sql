@@ -0,0 +1,36 @@
+create table experience_ledger (
+	entry_id uuid primary key not null default gen_random_uuid(),
+	user_id uuid not null,
+	amount bigint not null,
+	source text not null,
+	reference_id text,
+	note text,
+	created_at timestamp not null default now(),
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index experience_ledger_user_idx on experience_ledger (user_id, created_at);
+create index experience_ledger_created_at_idx on experience_ledger (created_at);
+
+-- Convert the current ranks into an opening balance: going from level n to n+1
+-- takes n * 1000 experience points (1000 for level 0)
+insert into experience_ledger (user_id, amount, source, note)
+select
+	user_id,
+	round(
+		case when floor(rank) = 0 then 0 else 1000 + 500 * floor(rank) * (floor(rank) - 1) end
+		+ (rank - floor(rank)) * 1000 * greatest(floor(rank), 1)
+	),
+	'opening_balance',
+	'Rank ' || rank || ' before the experience ledger'
+from user_experience
+where rank > 0;
+
+alter table user_experience add column experience bigint not null default 0;
+
+update user_experience set experience = coalesce((
+	select sum(amount) from experience_ledger where experience_ledger.user_id = user_experience.user_id
+), 0);
+
+alter table user_experience drop column rank;
@@ -0,0 +1,8 @@
+create table user_achievement (
+	user_id uuid not null,
+	achievement_id text not null,
+	unlocked_at timestamp not null,
+
+	foreign key (user_id) references "user"(user_id),
+	primary key (user_id, achievement_id)
+);
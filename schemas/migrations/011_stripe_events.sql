@@ -0,0 +1,11 @@
+create table stripe_event (
+	event_id text primary key not null,
+	type text not null,
+	status text not null,
+	error text,
+	attempts int not null default 1,
+	received_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index stripe_event_status_idx on stripe_event (status, received_at);
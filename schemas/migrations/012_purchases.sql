@@ -0,0 +1,16 @@
+create table purchase (
+	purchase_id uuid primary key not null default gen_random_uuid(),
+	user_id uuid not null,
+	session_id text not null unique,
+	payment_intent_id text,
+	amount bigint not null,
+	currency text not null,
+	product text not null,
+	status text not null,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index purchase_user_idx on purchase (user_id, created_at);
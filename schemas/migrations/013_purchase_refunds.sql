@@ -0,0 +1,4 @@
+alter table purchase add column amount_refunded bigint not null default 0;
+alter table purchase add column experience bigint not null default 0;
+
+update purchase set experience = 1000 where product = 'experience_1000';
@@ -0,0 +1,22 @@
+create table purchase_item (
+	purchase_id uuid not null,
+	item_id text not null,
+	quantity bigint not null,
+	amount bigint not null,
+	inventory_item_id text,
+
+	foreign key (purchase_id) references purchase(purchase_id),
+	primary key (purchase_id, item_id)
+);
+
+create table user_inventory (
+	user_id uuid not null,
+	item_id text not null,
+	quantity bigint not null default 0,
+
+	foreign key (user_id) references "user"(user_id),
+	primary key (user_id, item_id)
+);
+
+insert into purchase_item (purchase_id, item_id, quantity, amount)
+select purchase_id, product, 1, experience from purchase where product = 'experience_1000';
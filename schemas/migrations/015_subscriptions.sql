@@ -0,0 +1,14 @@
+create table subscription (
+	subscription_id text primary key not null,
+	user_id uuid not null,
+	customer_id text not null,
+	status text not null,
+	current_period_end timestamp,
+	cancel_at_period_end boolean not null default false,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index subscription_user_idx on subscription (user_id, created_at);
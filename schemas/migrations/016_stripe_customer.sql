@@ -0,0 +1,6 @@
+alter table "user" add column stripe_customer_id text unique;
+
+-- Link the users who subscribed to the customer of their latest subscription
+update "user" set stripe_customer_id = (
+	select customer_id from subscription where subscription.user_id = "user".user_id order by created_at desc limit 1
+) where exists (select 1 from subscription where subscription.user_id = "user".user_id);
@@ -0,0 +1,17 @@
+create table access_token (
+	token_id uuid primary key not null default gen_random_uuid(),
+	user_id uuid not null,
+	name text not null,
+	-- prefix is the beginning of the token, shown to tell tokens apart
+	prefix text not null,
+	token_hash text not null unique,
+	scopes text[] not null,
+	created_at timestamp not null default now(),
+	last_used_at timestamp,
+	expires_at timestamp,
+	revoked_at timestamp,
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index access_token_user_idx on access_token (user_id, created_at);
@@ -0,0 +1,8 @@
+-- completed is set on the completion that reached the target of its period
+alter table task_completion add column completed boolean not null default false;
+
+-- Periods cannot be recomputed here, so only the completions that reached
+-- the target on their own are marked as completed
+update task_completion set completed = true
+from user_task inner join task on task.task_id = user_task.task_id
+where user_task.user_task_id = task_completion.user_task_id and task_completion.quantity >= greatest(task.quantity, 1);
@@ -0,0 +1,6 @@
+alter table purchase add column inventory_granted boolean not null default false;
+
+-- Inventory items used to be granted once paid and never taken back
+update purchase set inventory_granted = true
+where status <> 'pending' and status <> 'failed'
+and exists (select 1 from purchase_item where purchase_item.purchase_id = purchase.purchase_id and purchase_item.inventory_item_id is not null);
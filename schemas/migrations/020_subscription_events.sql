@@ -0,0 +1,3 @@
+-- last_event_at is the creation time of the last Stripe event applied, the
+-- events older than it being skipped
+alter table subscription add column last_event_at timestamp not null default 'epoch';
@@ -0,0 +1,67 @@
+create table stripe_event (
+	event_id text primary key not null,
+	type text not null,
+	status text not null,
+	error text,
+	attempts int not null default 1,
+	received_at timestamp not null,
+	updated_at timestamp not null
+);
+
+create index stripe_event_status_idx on stripe_event (status, received_at);
+
+create table purchase (
+	purchase_id uuid primary key not null default gen_random_uuid(),
+	user_id uuid not null,
+	session_id text not null unique,
+	payment_intent_id text,
+	amount bigint not null,
+	amount_refunded bigint not null default 0,
+	currency text not null,
+	product text not null,
+	experience bigint not null default 0,
+	inventory_granted boolean not null default false,
+	status text not null,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index purchase_user_idx on purchase (user_id, created_at);
+
+create table purchase_item (
+	purchase_id uuid not null,
+	item_id text not null,
+	quantity bigint not null,
+	amount bigint not null,
+	inventory_item_id text,
+
+	foreign key (purchase_id) references purchase(purchase_id),
+	primary key (purchase_id, item_id)
+);
+
+create table user_inventory (
+	user_id uuid not null,
+	item_id text not null,
+	quantity bigint not null default 0,
+
+	foreign key (user_id) references "user"(user_id),
+	primary key (user_id, item_id)
+);
+
+create table subscription (
+	subscription_id text primary key not null,
+	user_id uuid not null,
+	customer_id text not null,
+	status text not null,
+	current_period_end timestamp,
+	cancel_at_period_end boolean not null default false,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	last_event_at timestamp not null default 'epoch',
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index subscription_user_idx on subscription (user_id, created_at);
@@ -6,28 +6,44 @@ create table task (
 	description text,
 	frequency text not null,
 	experience_gained int not null,
-	is_public boolean not null
+	is_public boolean not null,
+	owner_id uuid,
+	foreign key (owner_id) references "user"(user_id)
 );
 
 create table category (
 	category_id uuid primary key not null default gen_random_uuid(),
-	name text not null
+	name text not null,
+	user_id uuid,
+	foreign key (user_id) references "user"(user_id)
 );
 
 create table user_task (
 	user_task_id uuid primary key not null default gen_random_uuid(),
 	user_id uuid not null,
 	task_id uuid not null,
+	current_streak int not null default 0,
+	longest_streak int not null default 0,
+	streak_period_start timestamp,
+	archived_at timestamp,
 	foreign key (user_id) references "user"(user_id),
-	foreign key (task_id) references task(task_id)
+	foreign key (task_id) references task(task_id),
+	unique (user_id, task_id)
 );
 
 create table task_completion (
-	user_task_id uuid primary key not null,
+	completion_id uuid primary key not null default gen_random_uuid(),
+	user_task_id uuid not null,
 	complete_timestamp timestamp not null,
+	note text,
+	quantity int not null default 0,
+	experience_gained int not null default 0,
+	completed boolean not null default false,
 	foreign key (user_task_id) references user_task(user_task_id)
 );
 
+create index task_completion_user_task_idx on task_completion (user_task_id, complete_timestamp);
+
 create table task_category (
 	category_id uuid not null,
 	task_id uuid not null,
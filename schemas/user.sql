@@ -1,11 +1,56 @@
 create table "user" (
 	user_id uuid primary key not null default gen_random_uuid(),
-	cloud_iam_sub uuid not null
+	cloud_iam_sub uuid not null,
+	timezone text not null default 'UTC',
+	leaderboard_opt_out boolean not null default false,
+	stripe_customer_id text unique
 );
 
 create table user_experience (
 	user_id uuid primary key not null,
-	rank decimal not null,
+	experience bigint not null default 0,
 
 	foreign key (user_id) references "user"(user_id)
-)
+);
+
+create table experience_ledger (
+	entry_id uuid primary key not null default gen_random_uuid(),
+	user_id uuid not null,
+	amount bigint not null,
+	source text not null,
+	reference_id text,
+	note text,
+	created_at timestamp not null default now(),
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index experience_ledger_user_idx on experience_ledger (user_id, created_at);
+create index experience_ledger_created_at_idx on experience_ledger (created_at);
+
+create table user_achievement (
+	user_id uuid not null,
+	achievement_id text not null,
+	unlocked_at timestamp not null,
+
+	foreign key (user_id) references "user"(user_id),
+	primary key (user_id, achievement_id)
+);
+
+create table access_token (
+	token_id uuid primary key not null default gen_random_uuid(),
+	user_id uuid not null,
+	name text not null,
+	-- prefix is the beginning of the token, shown to tell tokens apart
+	prefix text not null,
+	token_hash text not null unique,
+	scopes text[] not null,
+	created_at timestamp not null default now(),
+	last_used_at timestamp,
+	expires_at timestamp,
+	revoked_at timestamp,
+
+	foreign key (user_id) references "user"(user_id)
+);
+
+create index access_token_user_idx on access_token (user_id, created_at);
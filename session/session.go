@@ -0,0 +1,112 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"server/common"
+	"server/principal"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sessions are cached in Redis under the hash of their access token until the
+// token expires, sparing the verification of the token and the lookup of the
+// user on every request. The sessions of each user are indexed so they can be
+// invalidated when the user changes.
+
+// Session is an authenticated access token
+type Session struct {
+	Principal principal.Principal `json:"principal"`
+	ExpiresAt time.Time           `json:"expires_at"`
+}
+
+func cacheKey(accessToken string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return "session:" + hex.EncodeToString(hash[:])
+}
+
+func userKey(userID string) string {
+	return "sessions:" + userID
+}
+
+// Get returns the cached session of an access token, if any
+func Get(accessToken string) (Session, bool, error) {
+	if common.Rdb == nil {
+		return Session{}, false, nil
+	}
+
+	raw, err := common.Rdb.Get(common.Ctx, cacheKey(accessToken)).Bytes()
+	if err == redis.Nil {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return Session{}, false, err
+	}
+
+	// The TTL is rounded by Redis, the session may outlive the token slightly
+	if !time.Now().Before(session.ExpiresAt) {
+		return Session{}, false, nil
+	}
+
+	return session, true, nil
+}
+
+// Save caches the session of an access token until it expires
+func Save(accessToken string, session Session) error {
+	if common.Rdb == nil {
+		return nil
+	}
+
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	key := cacheKey(accessToken)
+	index := userKey(session.Principal.UserID)
+
+	// The index lives as long as the longest session of the user
+	indexTTL, err := common.Rdb.TTL(common.Ctx, index).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = common.Rdb.TxPipelined(common.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(common.Ctx, key, raw, ttl)
+		pipe.SAdd(common.Ctx, index, key)
+		if indexTTL < ttl {
+			pipe.Expire(common.Ctx, index, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Invalidate removes the cached sessions of a user, so that their next
+// requests see the changes made to their profile, experience or subscription.
+// It must be called once these changes are committed.
+func Invalidate(userID string) error {
+	if common.Rdb == nil {
+		return nil
+	}
+
+	index := userKey(userID)
+	keys, err := common.Rdb.SMembers(common.Ctx, index).Result()
+	if err != nil {
+		return err
+	}
+
+	return common.Rdb.Del(common.Ctx, append(keys, index)...).Err()
+}
@@ -0,0 +1,170 @@
+package shop
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"server/common"
+	"server/models"
+)
+
+type ItemKind string
+
+const (
+	ItemKindExperience   ItemKind = "experience"
+	ItemKindStreakFreeze ItemKind = "streak_freeze"
+	ItemKindCosmetic     ItemKind = "cosmetic"
+)
+
+var (
+	ErrInvalidItem     = errors.New("invalid shop item")
+	ErrUnknownItem     = errors.New("unknown shop item")
+	ErrInvalidQuantity = errors.New("invalid quantity")
+)
+
+// Item is something users can buy. Items without a Stripe price are not
+// available.
+type Item struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Kind        ItemKind `json:"kind"`
+	// Amount is the experience points or the number of items granted per unit
+	Amount      int64  `json:"amount"`
+	StripePrice string `json:"-"`
+	MaxQuantity int64  `json:"max_quantity"`
+}
+
+// itemConfig is the representation of items in the catalog file, the Stripe
+// price being hidden from the API
+type itemConfig struct {
+	Item
+	StripePrice string `json:"stripe_price"`
+}
+
+//go:embed default.json
+var defaultItems []byte
+
+var items []Item
+
+// Load reads the items from a file, the default ones being used when path is
+// empty. Environment variables are expanded in the file.
+func Load(path string) error {
+	data := defaultItems
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse([]byte(os.ExpandEnv(string(data))))
+	if err != nil {
+		return err
+	}
+	items = parsed
+	return nil
+}
+
+// Parse parses and validates a JSON list of items, leaving out the ones
+// without a Stripe price unless payments are fake
+func Parse(data []byte) ([]Item, error) {
+	var configs []itemConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+
+	parsed := make([]Item, 0, len(configs))
+	ids := make(map[string]bool)
+	// Items are found by their price in the webhook, which must be unambiguous
+	prices := make(map[string]bool)
+	for _, config := range configs {
+		item := config.Item
+		item.StripePrice = config.StripePrice
+		if item.MaxQuantity == 0 {
+			item.MaxQuantity = 1
+		}
+
+		if item.ID == "" || ids[item.ID] || item.Amount < 1 || item.MaxQuantity < 1 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidItem, item.ID)
+		}
+		switch item.Kind {
+		case ItemKindExperience, ItemKindStreakFreeze, ItemKindCosmetic:
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidItem, item.ID)
+		}
+		ids[item.ID] = true
+
+		// The fake payments provider accepts any price
+		if item.StripePrice == "" && common.Config.PaymentsProvider == "fake" {
+			item.StripePrice = "price_fake_" + item.ID
+		}
+
+		if item.StripePrice != "" {
+			if prices[item.StripePrice] {
+				return nil, fmt.Errorf("%w: %q has the price of another item", ErrInvalidItem, item.ID)
+			}
+			prices[item.StripePrice] = true
+			parsed = append(parsed, item)
+		}
+	}
+
+	return parsed, nil
+}
+
+// Items returns the items available
+func Items() []Item {
+	return items
+}
+
+func ItemByID(id string) (Item, error) {
+	for _, item := range items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return Item{}, ErrUnknownItem
+}
+
+func ItemByStripePrice(price string) (Item, error) {
+	for _, item := range items {
+		if item.StripePrice == price {
+			return item, nil
+		}
+	}
+	return Item{}, ErrUnknownItem
+}
+
+// ValidateQuantity checks that a quantity of the item can be bought at once
+func (item Item) ValidateQuantity(quantity int64) error {
+	if quantity < 1 || quantity > item.MaxQuantity {
+		return ErrInvalidQuantity
+	}
+	return nil
+}
+
+// InventoryItemID returns the inventory entry the item is stored in, the
+// experience not being stored in the inventory
+func (item Item) InventoryItemID() string {
+	if item.Kind == ItemKindStreakFreeze {
+		return models.InventoryStreakFreeze
+	}
+	return item.ID
+}
+
+// PurchaseItem returns the purchase record of a quantity of the item
+func (item Item) PurchaseItem(quantity int64) models.PurchaseItem {
+	purchaseItem := models.PurchaseItem{
+		ItemID:   item.ID,
+		Quantity: quantity,
+		Amount:   item.Amount * quantity,
+	}
+	if item.Kind != ItemKindExperience {
+		inventoryItemID := item.InventoryItemID()
+		purchaseItem.InventoryItemID = &inventoryItemID
+	}
+	return purchaseItem
+}
@@ -0,0 +1,51 @@
+package shop
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+		err  error
+	}{
+		{"items", `[
+			{"id": "xp", "kind": "experience", "amount": 1000, "stripe_price": "price_xp"},
+			{"id": "freeze", "kind": "streak_freeze", "amount": 1, "stripe_price": "price_freeze"}
+		]`, []string{"xp", "freeze"}, nil},
+		{"item without price left out", `[
+			{"id": "xp", "kind": "experience", "amount": 1000, "stripe_price": "price_xp"},
+			{"id": "freeze", "kind": "streak_freeze", "amount": 1}
+		]`, []string{"xp"}, nil},
+		{"duplicate price", `[
+			{"id": "xp", "kind": "experience", "amount": 1000, "stripe_price": "price_xp"},
+			{"id": "freeze", "kind": "streak_freeze", "amount": 1, "stripe_price": "price_xp"}
+		]`, nil, ErrInvalidItem},
+		{"duplicate id", `[
+			{"id": "xp", "kind": "experience", "amount": 1000, "stripe_price": "price_xp"},
+			{"id": "xp", "kind": "experience", "amount": 5000, "stripe_price": "price_xp_5k"}
+		]`, nil, ErrInvalidItem},
+		{"unknown kind", `[{"id": "hat", "kind": "hat", "amount": 1, "stripe_price": "price_hat"}]`, nil, ErrInvalidItem},
+		{"zero amount", `[{"id": "xp", "kind": "experience", "amount": 0, "stripe_price": "price_xp"}]`, nil, ErrInvalidItem},
+	}
+
+	for _, test := range tests {
+		items, err := Parse([]byte(test.data))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: Parse() returned %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if len(items) != len(test.want) {
+			t.Errorf("%s: Parse() returned %d items, want %d", test.name, len(items), len(test.want))
+			continue
+		}
+		for i, item := range items {
+			if item.ID != test.want[i] {
+				t.Errorf("%s: item %d is %q, want %q", test.name, i, item.ID, test.want[i])
+			}
+		}
+	}
+}